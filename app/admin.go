@@ -0,0 +1,421 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/taskqueue"
+)
+
+// errNotServing is returned on pinning a problem which is not to be served
+var errNotServing = errors.New("problem is not to be served")
+
+const (
+	adminHistoryCount = 20
+	adminReviewCount  = 20
+	adminReportCount  = 50
+)
+
+type stockStat struct {
+	Type    int
+	Serving int
+	// Unused is the number of the problems not served yet on each of entity.Channels
+	Unused       []int
+	Pending      int
+	Rejected     int
+	Retired      int
+	Paused       int
+	Difficulties []int
+}
+
+type reportItem struct {
+	Key    string
+	Report *entity.Report
+}
+
+type historyItem struct {
+	Key     string
+	History *entity.History
+}
+
+// adminHandler serves the dashboard of the problem stock
+func (s *server) adminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	stats := []*stockStat{}
+	for _, problemType := range []generator.Problem{generator.Type1, generator.Type3, generator.Type5} {
+		stat, err := s.countStock(ctx, problemType)
+		if err != nil {
+			log.Errorf(ctx, "failed to count stock: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		stats = append(stats, stat)
+	}
+	histories := map[string][]*historyItem{}
+	for _, action := range []string{entity.HistoryActionGenerate, entity.HistoryActionDelete} {
+		items, err := recentHistories(ctx, action)
+		if err != nil {
+			log.Errorf(ctx, "failed to fetch histories: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		histories[action] = items
+	}
+
+	difficulties := make([]int, entity.DifficultyMax)
+	for i := range difficulties {
+		difficulties[i] = i + 1
+	}
+	if err := renderTemplate(w, "admin", map[string]interface{}{
+		"stockCount":   entity.ProblemStockCount,
+		"curation":     s.config.Curation.Enabled,
+		"channels":     entity.Channels,
+		"stats":        stats,
+		"difficulties": difficulties,
+		"generations":  histories[entity.HistoryActionGenerate],
+		"deletions":    histories[entity.HistoryActionDelete],
+	}); err != nil {
+		log.Errorf(ctx, "failed to render template: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// adminProblemHandler shows the problem, and changes its state, pins or regenerates it on POST
+func (s *server) adminProblemHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	encodedKey := r.FormValue("key")
+	problem, key, err := getProblem(ctx, encodedKey)
+	if err != nil {
+		log.Infof(ctx, "failed to get problem: %v", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if !sameOrigin(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		redirectKey, err := s.adminAction(ctx, r.FormValue("action"), problem, key)
+		if err == errNotServing {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Errorf(ctx, "failed to %s problem: %v", r.FormValue("action"), err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/admin/problem?key="+url.QueryEscape(redirectKey.Encode()), http.StatusSeeOther)
+		return
+	}
+
+	usages := []*entity.Usage{}
+	if _, err := datastore.NewQuery(entity.KindNameUsage).
+		Ancestor(key).
+		Order("-created_at").
+		GetAll(ctx, &usages); err != nil {
+		log.Errorf(ctx, "failed to fetch usages: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if err := renderTemplate(w, "admin_problem", map[string]interface{}{
+		"key":     encodedKey,
+		"problem": problem,
+		"usages":  usages,
+	}); err != nil {
+		log.Errorf(ctx, "failed to render template: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// adminReviewHandler serves the queue of the problems waiting for review, and approves or rejects them on POST
+func (s *server) adminReviewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	if r.Method == http.MethodPost {
+		if !sameOrigin(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		action := r.FormValue("action")
+		if action != "approve" && action != "reject" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		problem, key, err := getProblem(ctx, r.FormValue("key"))
+		if err != nil {
+			log.Infof(ctx, "failed to get problem: %v", err.Error())
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := s.adminAction(ctx, action, problem, key); err != nil {
+			log.Errorf(ctx, "failed to %s problem: %v", action, err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/admin/review", http.StatusSeeOther)
+		return
+	}
+
+	// oldest first
+	items := make([]*problemItem, 0, adminReviewCount)
+	iter := datastore.NewQuery(entity.KindNameProblem).
+		Filter("state = ", entity.ProblemStatePending).
+		Order("created_at").
+		Limit(adminReviewCount).
+		Run(ctx)
+	for {
+		var problem entity.Problem
+		key, err := iter.Next(&problem)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			log.Errorf(ctx, "failed to fetch problems: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		items = append(items, &problemItem{Key: key.Encode(), Problem: &problem})
+	}
+	if err := renderTemplate(w, "admin_review", map[string]interface{}{
+		"items":    items,
+		"curation": s.config.Curation.Enabled,
+	}); err != nil {
+		log.Errorf(ctx, "failed to render template: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// adminReportsHandler lists the recent reports from users and the problems paused by them
+func (s *server) adminReportsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	reports := make([]*reportItem, 0, adminReportCount)
+	iter := datastore.NewQuery(entity.KindNameReport).
+		Order("-created_at").
+		Limit(adminReportCount).
+		Run(ctx)
+	for {
+		var report entity.Report
+		key, err := iter.Next(&report)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			log.Errorf(ctx, "failed to fetch reports: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		reports = append(reports, &reportItem{Key: key.Parent().Encode(), Report: &report})
+	}
+	paused := []*problemItem{}
+	iter = datastore.NewQuery(entity.KindNameProblem).
+		Filter("state = ", entity.ProblemStatePaused).
+		Order("created_at").
+		Run(ctx)
+	for {
+		var problem entity.Problem
+		key, err := iter.Next(&problem)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			log.Errorf(ctx, "failed to fetch problems: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		paused = append(paused, &problemItem{Key: key.Encode(), Problem: &problem})
+	}
+	if err := renderTemplate(w, "admin_reports", map[string]interface{}{
+		"reports": reports,
+		"paused":  paused,
+	}); err != nil {
+		log.Errorf(ctx, "failed to render template: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// adminAction executes the action and returns the key of the problem to be shown
+func (s *server) adminAction(ctx context.Context, action string, problem *entity.Problem, key *datastore.Key) (*datastore.Key, error) {
+	switch action {
+	case "approve", "reject", "retire":
+		state := map[string]string{
+			"approve": entity.ProblemStateApproved,
+			"reject":  entity.ProblemStateRejected,
+			"retire":  entity.ProblemStateRetired,
+		}[action]
+		err := updateProblem(ctx, key, func(ctx context.Context, problem *entity.Problem) error {
+			if err := problem.SetState(state); err != nil {
+				return err
+			}
+			// reports so far are settled by the review
+			if state == entity.ProblemStateApproved {
+				problem.Reports = 0
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	case "pin":
+		// pin as the problem of today, only if it is to be served
+		date := today()
+		err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+			var latest entity.Problem
+			if err := datastore.Get(ctx, key, &latest); err != nil {
+				return err
+			}
+			serving := false
+			for _, state := range s.servingStates() {
+				serving = serving || latest.State == state
+			}
+			if !serving {
+				return errNotServing
+			}
+			daily := &entity.Daily{
+				Date:      date,
+				Type:      latest.Type,
+				Problem:   key,
+				CreatedAt: time.Now(),
+			}
+			_, err := datastore.Put(ctx, entity.DailyKey(ctx, date, latest.Type), daily)
+			return err
+		}, &datastore.TransactionOptions{XG: true})
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	case "regenerate":
+		// retire the problem and generate a new one of the same type in the task queue
+		problemType := parseProblemType(strconv.Itoa(problem.Type))
+		if problemType == nil {
+			return nil, fmt.Errorf("invalid type: %d", problem.Type)
+		}
+		task := taskqueue.NewPOSTTask("/tasks/generate", url.Values{
+			"type":  {strconv.Itoa(problemType.Steps())},
+			"count": {"1"},
+		})
+		err := updateProblem(ctx, key, func(ctx context.Context, problem *entity.Problem) error {
+			if err := problem.SetState(entity.ProblemStateRetired); err != nil {
+				return err
+			}
+			// added in the transaction, so that a new problem is generated only if this one is retired
+			_, err := taskqueue.Add(ctx, task, "")
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	return key, nil
+}
+
+// updateProblem re-reads the problem and puts it after f modifies it, in a transaction
+func updateProblem(ctx context.Context, key *datastore.Key, f func(ctx context.Context, problem *entity.Problem) error) error {
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var problem entity.Problem
+		if err := datastore.Get(ctx, key, &problem); err != nil {
+			return err
+		}
+		if err := f(ctx, &problem); err != nil {
+			return err
+		}
+		_, err := datastore.Put(ctx, key, &problem)
+		return err
+	}, nil)
+}
+
+func (s *server) countStock(ctx context.Context, problemType generator.Problem) (*stockStat, error) {
+	query := datastore.NewQuery(entity.KindNameProblem).Filter("type = ", problemType.Steps())
+	stat := &stockStat{
+		Type:         problemType.Steps(),
+		Unused:       make([]int, len(entity.Channels)),
+		Difficulties: make([]int, entity.DifficultyMax),
+	}
+	count := func(q *datastore.Query, n *int) error {
+		c, err := q.Count(ctx)
+		if err != nil {
+			return err
+		}
+		*n += c
+		return nil
+	}
+	for _, state := range s.servingStates() {
+		q := query.Filter("state = ", state)
+		if err := count(q, &stat.Serving); err != nil {
+			return nil, err
+		}
+		for i, channel := range entity.Channels {
+			if err := count(q.Filter("unused = ", channel), &stat.Unused[i]); err != nil {
+				return nil, err
+			}
+		}
+		// difficulty distribution of the serving stock
+		for d := 1; d <= entity.DifficultyMax; d++ {
+			if err := count(q.Filter("difficulty = ", d), &stat.Difficulties[d-1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for state, n := range map[string]*int{
+		entity.ProblemStatePending:  &stat.Pending,
+		entity.ProblemStateRejected: &stat.Rejected,
+		entity.ProblemStateRetired:  &stat.Retired,
+		entity.ProblemStatePaused:   &stat.Paused,
+	} {
+		if err := count(query.Filter("state = ", state), n); err != nil {
+			return nil, err
+		}
+	}
+	return stat, nil
+}
+
+func recentHistories(ctx context.Context, action string) ([]*historyItem, error) {
+	items := []*historyItem{}
+	iter := datastore.NewQuery(entity.KindNameHistory).
+		Filter("action = ", action).
+		Order("-created_at").
+		Limit(adminHistoryCount).
+		Run(ctx)
+	for {
+		var history entity.History
+		_, err := iter.Next(&history)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &historyItem{Key: history.Problem.Encode(), History: &history})
+	}
+	return items, nil
+}
+
+// sameOrigin returns false if the request is sent from other sites, or without the Origin header
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/sugyan/shogi/format/csa"
+	"github.com/sugyan/shogi/util/image"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
+)
+
+// animationHandler serves the animated image of the solution as GIF (.gif) or APNG (.png)
+func (s *server) animationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	name := strings.TrimPrefix(r.URL.Path, "/animation/")
+	ext := path.Ext(name)
+	if ext != ".gif" && ext != ".png" {
+		http.NotFound(w, r)
+		return
+	}
+	encoded, theme := strings.TrimSuffix(name, ext), r.URL.Query().Get("theme")
+	// the animation never changes, since the record of the problem is immutable
+	cacheKey := fmt.Sprintf("animation:%s%s:%s", encoded, ext, theme)
+	var data []byte
+	if item, err := memcache.Get(ctx, cacheKey); err == nil {
+		data = item.Value
+	} else {
+		if err != memcache.ErrCacheMiss {
+			log.Warningf(ctx, "failed to get cache: %v", err.Error())
+		}
+		problem, _, err := getProblem(ctx, encoded)
+		if err != nil {
+			log.Infof(ctx, "failed to get problem: %v", err.Error())
+			http.NotFound(w, r)
+			return
+		}
+		style, err := s.styleOptions(theme, nil)
+		if err != nil {
+			log.Infof(ctx, "invalid theme: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := encodeAnimation(buf, problem, ext, style); err != nil {
+			log.Errorf(ctx, "failed to generate animation: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		data = buf.Bytes()
+		// best effort, which fails for the animations larger than the limit of memcache
+		if err := memcache.Set(ctx, &memcache.Item{Key: cacheKey, Value: data}); err != nil {
+			log.Warningf(ctx, "failed to set cache: %v", err.Error())
+		}
+	}
+	if ext == ".gif" {
+		w.Header().Set("Content-Type", "image/gif")
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(data)
+}
+
+func encodeAnimation(buf *bytes.Buffer, problem *entity.Problem, ext string, style *image.StyleOptions) error {
+	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
+	if err != nil {
+		return err
+	}
+	frames, err := render.Frames(record, style)
+	if err != nil {
+		return err
+	}
+	if ext == ".gif" {
+		return render.EncodeGIF(buf, frames)
+	}
+	return render.EncodeAPNG(buf, frames)
+}
+
+func animationURL(host, encodedKey, ext, theme string) string {
+	u := "https://" + host + "/animation/" + encodedKey + ext
+	if theme != "" {
+		u += "?theme=" + url.QueryEscape(theme)
+	}
+	return u
+}
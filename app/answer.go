@@ -3,12 +3,15 @@ package app
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"html/template"
 	"net/http"
 	"strings"
 
 	"github.com/sugyan/shogi"
 	"github.com/sugyan/shogi/format/csa"
 	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
 	"google.golang.org/appengine"
 	"google.golang.org/appengine/datastore"
 	"google.golang.org/appengine/log"
@@ -23,7 +26,7 @@ func (s *server) answerHandler(w http.ResponseWriter, r *http.Request) {
 		csa = true
 		encodedKey = strings.TrimSuffix(encodedKey, ".csa")
 	}
-	problem, _, err := getProblem(ctx, encodedKey)
+	problem, key, err := getProblem(ctx, encodedKey)
 	if err != nil {
 		log.Infof(ctx, "failed to get problem: %v", err.Error())
 		http.NotFound(w, r)
@@ -34,6 +37,10 @@ func (s *server) answerHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(problem.CSA))
 		return
 	}
+	if level := parseHintLevel(r.URL.Query().Get("hint")); level > 0 {
+		s.renderHint(w, r, problem, key, level)
+		return
+	}
 	answer, _, err := generateAnswer(problem)
 	if err != nil {
 		log.Errorf(ctx, "failed to retrieve answer: %v", err.Error())
@@ -41,8 +48,31 @@ func (s *server) answerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := renderTemplate(w, "answer", map[string]string{
-		"answer": strings.Join(answer, " "),
+	board := bytes.NewBuffer(nil)
+	if err := renderSVG(board, problem, false, ""); err != nil {
+		log.Errorf(ctx, "failed to render board: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	description, err := describeProblem(problem)
+	if err != nil {
+		log.Errorf(ctx, "failed to describe problem: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := renderTemplate(w, "answer", map[string]interface{}{
+		"title":       fmt.Sprintf("%d手詰の問題", problem.Type),
+		"url":         "https://" + appengine.DefaultVersionHostname(ctx) + r.URL.Path,
+		"image":       problem.QImage,
+		"answer":      strings.Join(answer, " "),
+		"board":       template.HTML(board.String()),
+		"description": description,
+		"key":         encodedKey,
+		"reasons":     reportReasons,
+		"reported":    r.URL.Query().Get("reported") != "",
+		"twitterSite": s.config.Card.TwitterSite,
 	}); err != nil {
 		log.Errorf(ctx, "failed to render template: %v", err.Error())
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -50,6 +80,31 @@ func (s *server) answerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *server) renderHint(w http.ResponseWriter, r *http.Request, problem *entity.Problem, key *datastore.Key, level int) {
+	ctx := appengine.NewContext(r)
+
+	theme := r.URL.Query().Get("theme")
+	h, err := generateHint(ctx, problem, key, level, theme)
+	if err != nil {
+		log.Errorf(ctx, "failed to generate hint: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"hint":  h,
+		"path":  r.URL.Path,
+		"theme": theme,
+	}
+	if level < hintLevelMax {
+		data["next"] = level + 1
+	}
+	if err := renderTemplate(w, "hint", data); err != nil {
+		log.Errorf(ctx, "failed to render template: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
 func generateAnswer(problem *entity.Problem) ([]string, *shogi.State, error) {
 	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
 	if err != nil {
@@ -68,6 +123,14 @@ func generateAnswer(problem *entity.Problem) ([]string, *shogi.State, error) {
 	return answer, state, nil
 }
 
+func describeProblem(problem *entity.Problem) (*render.Description, error) {
+	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
+	if err != nil {
+		return nil, err
+	}
+	return render.Describe(record.State), nil
+}
+
 func getProblem(ctx context.Context, encoded string) (*entity.Problem, *datastore.Key, error) {
 	var problem entity.Problem
 	key, err := datastore.DecodeKey(encoded)
@@ -7,14 +7,28 @@ import (
 	"time"
 
 	"github.com/ChimeraCoder/anaconda"
+	"github.com/sugyan/shogi"
 	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/shogi/util/image"
+	"github.com/sugyan/tsumeshogi-bot/auth"
 	"github.com/sugyan/tsumeshogi-bot/config"
 	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
+	"github.com/sugyan/tsumeshogi-bot/selection"
+	"golang.org/x/image/font"
+	"google.golang.org/appengine"
 	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
 )
 
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+
 type server struct {
-	config *config.Config
+	config   *config.Config
+	auth     *auth.Authenticator
+	cardFace font.Face
+	// searchSlots limits the searches of problems running on the instance, shared by the worker and the tasks
+	searchSlots chan struct{}
 }
 
 func init() {
@@ -25,57 +39,165 @@ func init() {
 	anaconda.SetConsumerKey(config.TwitterBot.ConsumerKey)
 	anaconda.SetConsumerSecret(config.TwitterBot.ConsumerSecret)
 
+	workers := config.Worker.Workers
+	if workers < 1 {
+		workers = 1
+	}
 	server := &server{
-		config: config,
+		config:      config,
+		searchSlots: make(chan struct{}, workers),
+		auth: &auth.Authenticator{
+			// never open to everyone on the production
+			DevMode:      config.Auth.DevMode && (!appengine.IsAppEngine() || appengine.IsDevAppServer()),
+			Unauthorized: unauthorized,
+		},
+	}
+	for _, t := range config.Auth.Tokens {
+		server.auth.AddToken(t.Token, t.Scopes...)
+	}
+	// the headers and the users are trusted only on App Engine, outside of which tokens are required
+	if appengine.IsAppEngine() {
+		server.auth.AddVerifier(appengineVerifier)
+	}
+	if err := server.selector().Validate(); err != nil {
+		panic(err)
+	}
+	if config.Card.Font != "" {
+		face, err := loadFontFace(config.Card.Font, cardFontSize)
+		if err != nil {
+			panic(err)
+		}
+		server.cardFace = face
 	}
 	http.HandleFunc("/callback", server.callbackHandler)
-	http.HandleFunc("/tweet", server.tweetHandler)
+	http.HandleFunc("/tweet", server.auth.Require(auth.ScopeCron, server.tweetHandler))
+	http.HandleFunc("/tasks/generate", server.auth.Require(auth.ScopeCron, server.generateTaskHandler))
+	http.HandleFunc("/tasks/stock", server.auth.Require(auth.ScopeCron, server.stockTaskHandler))
+	http.HandleFunc("/_ah/start", server.startHandler)
 	http.HandleFunc("/answer/", server.answerHandler)
-	http.HandleFunc("/problem", server.problemHandler)
+	http.HandleFunc("/hint/", server.hintImageHandler)
+	http.HandleFunc("/animation/", server.animationHandler)
+	http.HandleFunc("/image/", server.imageHandler)
+	http.HandleFunc("/play/", server.playHandler)
+	http.HandleFunc("/result/", server.resultHandler)
+	http.HandleFunc("/report/", server.reportHandler)
+	http.HandleFunc("/problem", server.auth.Require(auth.ScopeProblem, server.problemHandler))
+	http.HandleFunc("/problems", server.problemsHandler)
+	http.HandleFunc("/daily", server.dailyHandler)
+	http.HandleFunc("/daily/", server.dailyHandler)
+	http.HandleFunc("/feed.atom", server.feedHandler)
+	http.HandleFunc("/admin", server.auth.Require(auth.ScopeAdmin, server.adminHandler))
+	http.HandleFunc("/admin/problem", server.auth.Require(auth.ScopeAdmin, server.adminProblemHandler))
+	http.HandleFunc("/admin/review", server.auth.Require(auth.ScopeAdmin, server.adminReviewHandler))
+	http.HandleFunc("/admin/reports", server.auth.Require(auth.ScopeAdmin, server.adminReportsHandler))
+	http.HandleFunc("/slack/commands", server.slackCommandsHandler)
+	http.HandleFunc("/slack/interactions", server.slackInteractionsHandler)
+	http.HandleFunc("/telegram", server.telegramHandler)
 
 	rand.Seed(time.Now().UnixNano())
 }
 
-func (s *server) fetchProblem(ctx context.Context, problemType generator.Problem) (*entity.Problem, *datastore.Key, error) {
-	// fetch high scored problems
-	baseQuery := datastore.NewQuery(entity.KindNameProblem).
-		Filter("type = ", problemType.Steps()).
-		Order("-score")
-	candidates := make([]*datastore.Key, 0, 10)
-fetch:
-	for _, used := range []bool{false, true} {
-		iter := baseQuery.Filter("used = ", used).Run(ctx)
-		for {
-			key, err := iter.Next(nil)
-			if err != nil {
-				if err == datastore.Done {
-					continue fetch
-				} else {
-					return nil, nil, err
-				}
-			}
-			candidates = append(candidates, key)
-			if len(candidates) >= 10 {
-				break fetch
-			}
-		}
+// styleOptions returns the image style of the theme, or of the default theme in config if empty
+func (s *server) styleOptions(theme string, highlight *shogi.Position) (*image.StyleOptions, error) {
+	if theme == "" {
+		theme = s.config.Theme.Default
+	}
+	return render.Style(theme, highlight)
+}
+
+// svgCSS returns the CSS of the SVG image of the theme, or of the default theme in config if empty
+func (s *server) svgCSS(theme string) (string, error) {
+	if theme == "" {
+		theme = s.config.Theme.Default
+	}
+	return render.SVGCSS(theme)
+}
+
+// parseProblemType returns the problem type for "1", "3" or "5", or nil if invalid
+func parseProblemType(s string) generator.Problem {
+	switch s {
+	case "1":
+		return generator.Type1
+	case "3":
+		return generator.Type3
+	case "5":
+		return generator.Type5
+	}
+	return nil
+}
+
+// servingStates returns the review states of the problems to be served
+func (s *server) servingStates() []string {
+	if s.config.Curation.Enabled {
+		return []string{entity.ProblemStateApproved}
+	}
+	return []string{entity.ProblemStateApproved, entity.ProblemStatePending}
+}
+
+// selector returns the selector of the strategies configured for the channels
+func (s *server) selector() *selection.Selector {
+	return &selection.Selector{
+		Default:  s.config.Selection.Default,
+		Channels: s.config.Selection.Channels,
+		States:   s.servingStates(),
+	}
+}
+
+// peekProblem selects a problem for the channel without marking it as used
+func (s *server) peekProblem(ctx context.Context, problemType generator.Problem, channel string) (*entity.Problem, *datastore.Key, error) {
+	candidates, err := s.selector().Candidates(ctx, problemType, channel)
+	if err != nil {
+		return nil, nil, err
 	}
 	if len(candidates) == 0 {
-		return nil, nil, datastore.Done
+		return nil, nil, errNoProblem
 	}
-	// select from candidates randomly
-	key := candidates[rand.Intn(len(candidates))]
+	key := candidates[0].Key
 	var problem entity.Problem
 	if err := datastore.Get(ctx, key, &problem); err != nil {
 		return nil, nil, err
 	}
-	// mark as used
-	if !problem.Used {
-		problem.Used = true
-		problem.UpdatedAt = time.Now()
-		if _, err := datastore.Put(ctx, key, &problem); err != nil {
-			return nil, nil, err
+	return &problem, key, nil
+}
+
+// number of selections tried by reserveProblem
+const reserveAttempts = 3
+
+// reserveProblem selects a problem to be posted on the channel, and records the usage with the context ID.
+// Candidates are marked as used in transactions, so that concurrent requests never take the same unused problem.
+// repeated is true if the problem is served on the channel before, because no unused problem is left.
+// The stock is checked in the task queue after the reservation.
+func (s *server) reserveProblem(ctx context.Context, problemType generator.Problem, channel, contextID string) (problem *entity.Problem, key *datastore.Key, repeated bool, err error) {
+	return s.reserveProblemWith(ctx, problemType, channel, contextID, nil)
+}
+
+// reserveProblemWith is reserveProblem which also calls f in the transaction of the reservation (see entity.ReserveWith)
+func (s *server) reserveProblemWith(ctx context.Context, problemType generator.Problem, channel, contextID string, f func(ctx context.Context, key *datastore.Key) error) (problem *entity.Problem, key *datastore.Key, repeated bool, err error) {
+	for attempt := 0; attempt < reserveAttempts; attempt++ {
+		candidates, err := s.selector().Candidates(ctx, problemType, channel)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if len(candidates) == 0 {
+			return nil, nil, false, errNoProblem
+		}
+		// try candidates in the order of the strategy
+		for _, c := range candidates {
+			problem, err := entity.ReserveWith(ctx, c.Key, channel, contextID, c.Unused, s.servingStates(), f)
+			if err == entity.ErrProblemTaken {
+				log.Infof(ctx, "problem %v is taken", c.Key.IntID())
+				continue
+			}
+			if err != nil {
+				return nil, nil, false, err
+			}
+			if err := s.enqueueStockCheck(ctx, problemType, channel); err != nil {
+				log.Errorf(ctx, "failed to enqueue stock check: %v", err.Error())
+			}
+			return problem, c.Key, !c.Unused, nil
 		}
 	}
-	return &problem, key, nil
+	// every candidate is taken by the concurrent requests, which is handled as no problem left
+	log.Warningf(ctx, "candidates are taken %d times", reserveAttempts)
+	return nil, nil, false, errNoProblem
 }
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/sugyan/tsumeshogi-bot/auth"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/user"
+)
+
+// appengineVerifier authorizes the cron and task queue requests, and the administrators logged in with Google accounts for all scopes.
+// It must be registered only on App Engine.
+func appengineVerifier(r *http.Request, scope string) bool {
+	// App Engine removes these headers from external requests
+	if scope == auth.ScopeCron && (r.Header.Get("X-Appengine-Cron") == "true" || r.Header.Get("X-Appengine-Queuename") != "") {
+		return true
+	}
+	return user.IsAdmin(appengine.NewContext(r))
+}
+
+// unauthorized redirects the browsers to the login page for the admin pages
+func unauthorized(w http.ResponseWriter, r *http.Request, scope string) {
+	ctx := appengine.NewContext(r)
+	if appengine.IsAppEngine() && scope == auth.ScopeAdmin && r.Method == http.MethodGet &&
+		auth.BearerToken(r) == "" && user.Current(ctx) == nil {
+		loginURL, err := user.LoginURL(ctx, r.URL.String())
+		if err == nil {
+			http.Redirect(w, r, loginURL, http.StatusFound)
+			return
+		}
+		log.Errorf(ctx, "failed to get login URL: %v", err.Error())
+	}
+	log.Infof(ctx, "unauthorized request for scope '%s': %s", scope, r.URL.Path)
+	w.Header().Set("WWW-Authenticate", `Bearer scope="`+scope+`"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -1,16 +1,17 @@
 package app
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/line/line-bot-sdk-go/linebot"
-	"github.com/sugyan/shogi/format/csa"
 	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
 	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
 	"google.golang.org/appengine/log"
 	"google.golang.org/appengine/urlfetch"
 )
@@ -47,14 +48,29 @@ func (s *server) callbackHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// maximum length of altText
+const lineAltTextMax = 400
+
+// postback actions
+const (
+	postbackAnswer = "answer"
+	postbackHint   = "hint"
+	postbackReport = "report"
+)
+
 func (s *server) handleBotEvent(ctx context.Context, bot *linebot.Client, event *linebot.Event) error {
 	switch event.Type {
 	case linebot.EventTypeMessage:
 		if message, ok := event.Message.(*linebot.TextMessage); ok {
-			var (
-				problemType  generator.Problem
-				replyMessage linebot.Message
-			)
+			if strings.HasPrefix(message.Text, "今日の問題") {
+				replyMessage, err := s.dailyFlexMessage(ctx)
+				if err != nil {
+					return err
+				}
+				_, err = bot.ReplyMessage(event.ReplyToken, replyMessage).WithContext(ctx).Do()
+				return err
+			}
+			var problemType generator.Problem
 			switch {
 			case strings.HasPrefix(message.Text, "1手詰"):
 				problemType = generator.Type1
@@ -66,56 +82,265 @@ func (s *server) handleBotEvent(ctx context.Context, bot *linebot.Client, event
 			if problemType == nil {
 				return nil
 			}
-			problem, key, err := s.fetchProblem(ctx, problemType)
+			problem, key, repeated, err := s.reserveProblem(ctx, problemType, entity.ChannelLineBot, lineSourceID(event.Source))
+			if err == errNoProblem {
+				_, err := bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(noProblemMessage)).WithContext(ctx).Do()
+				return err
+			}
 			if err != nil {
 				return err
 			}
-			text := fmt.Sprintf("%d手詰の問題です！", problemType.Steps())
-			replyMessage = linebot.NewTemplateMessage(
-				text+" LINEアプリでご覧ください",
-				linebot.NewButtonsTemplate(
-					problem.QImage, "", text,
-					linebot.NewURITemplateAction("画像URL", problem.QImage),
-					linebot.NewPostbackTemplateAction(
-						"正解を見る",
-						key.Encode(),
-						"",
-						"",
-					),
-				),
-			)
-			_, err = bot.ReplyMessage(event.ReplyToken, replyMessage).WithContext(ctx).Do()
+			replyMessage, err := problemFlexMessage(problem, key, repeated)
 			if err != nil {
 				return err
 			}
+			if _, err := bot.ReplyMessage(event.ReplyToken, replyMessage).WithContext(ctx).Do(); err != nil {
+				return err
+			}
 		}
 	case linebot.EventTypePostback:
-		var replyMessage linebot.Message
-		s := strings.Split(event.Postback.Data, ":")
-		encoded := s[0]
-		problem, _, err := getProblem(ctx, encoded)
-		if err != nil {
-			return err
+		var replyMessages []linebot.SendingMessage
+		// "<encoded key>", "<encoded key>:<action>", "<encoded key>:hint:<level>" or "<encoded key>:report:<reason>"
+		data := strings.Split(event.Postback.Data, ":")
+		encoded, action := data[0], postbackAnswer
+		if len(data) > 1 {
+			action = data[1]
 		}
-		record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
+		problem, key, err := getProblem(ctx, encoded)
 		if err != nil {
 			return err
 		}
-		answer, err := record.State.MoveStrings(record.Moves)
+		switch action {
+		case postbackHint:
+			level := hintLevelPiece
+			if len(data) > 2 && parseHintLevel(data[2]) > 0 {
+				level = parseHintLevel(data[2])
+			}
+			replyMessages, err = hintMessages(ctx, problem, key, level, s.config.Theme.LineBot)
+		case postbackReport:
+			if len(data) > 2 && reportReasonLabel(data[2]) != "" {
+				if err := s.reportProblem(ctx, key, data[2], entity.ReportSourceLineBot, lineReporterID(event.Source)); err != nil {
+					return err
+				}
+				replyMessages = []linebot.SendingMessage{
+					linebot.NewTextMessage("報告ありがとうございます！").WithQuickReplies(quickReplyItems(nil, 0)),
+				}
+			} else {
+				replyMessages = []linebot.SendingMessage{reportReasonMessage(key)}
+			}
+		default:
+			replyMessages, err = answerFlexMessage(problem, key, animationURL(appengine.DefaultVersionHostname(ctx), key.Encode(), ".png", s.config.Theme.LineBot))
+		}
 		if err != nil {
 			return err
 		}
-		text := fmt.Sprintf("正解は…\n%s です！", strings.Join(answer, " "))
-		replyMessage = linebot.NewTemplateMessage(
-			text,
-			linebot.NewButtonsTemplate(
-				problem.AImage, "", text,
-				linebot.NewMessageTemplateAction("もう1問！", fmt.Sprintf("%d手詰", problem.Type)),
-			),
-		)
-		if _, err := bot.ReplyMessage(event.ReplyToken, replyMessage).WithContext(ctx).Do(); err != nil {
+		if _, err := bot.ReplyMessage(event.ReplyToken, replyMessages...).WithContext(ctx).Do(); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// lineSourceID returns the ID of the group, the room or the user where the event occurred
+func lineSourceID(source *linebot.EventSource) string {
+	if source == nil {
+		return ""
+	}
+	switch {
+	case source.GroupID != "":
+		return source.GroupID
+	case source.RoomID != "":
+		return source.RoomID
+	}
+	return source.UserID
+}
+
+// lineReporterID returns the ID of the user who reports, or of the group or the room if the user is unknown
+func lineReporterID(source *linebot.EventSource) string {
+	if source != nil && source.UserID != "" {
+		return source.UserID
+	}
+	return lineSourceID(source)
+}
+
+func problemFlexMessage(problem *entity.Problem, key *datastore.Key, repeated bool) (linebot.SendingMessage, error) {
+	description, err := describeProblem(problem)
+	if err != nil {
+		return nil, err
+	}
+	text := fmt.Sprintf("%d手詰の問題です！", problem.Type)
+	contents := problemBubble(problem, key, text)
+	if repeated {
+		contents.Body.Contents = append(contents.Body.Contents, &linebot.TextComponent{
+			Type:  linebot.FlexComponentTypeText,
+			Text:  repeatedNotice,
+			Size:  linebot.FlexTextSizeTypeXs,
+			Color: "#888888",
+			Wrap:  true,
+		})
+		text += "\n" + repeatedNotice
+	}
+	// altText is shown by the clients which cannot render Flex Message, and read by screen readers
+	altText := render.Truncate(fmt.Sprintf("%s\n%s\n%s", text, problem.QImage, description.Japanese), lineAltTextMax)
+	return linebot.NewFlexMessage(altText, contents).WithQuickReplies(quickReplyItems(key, hintLevelPiece)), nil
+}
+
+// dailyFlexMessage returns the carousel of the problems of the day
+func (s *server) dailyFlexMessage(ctx context.Context) (linebot.SendingMessage, error) {
+	date := today()
+	contents := &linebot.CarouselContainer{
+		Type: linebot.FlexContainerTypeCarousel,
+	}
+	lines := []string{date + "の問題です！"}
+	for _, problemType := range []generator.Problem{generator.Type1, generator.Type3, generator.Type5} {
+		problem, key, err := s.dailyProblem(ctx, date, problemType)
+		if err != nil {
+			return nil, err
+		}
+		text := fmt.Sprintf("今日の%d手詰です！", problem.Type)
+		contents.Contents = append(contents.Contents, problemBubble(problem, key, text))
+		lines = append(lines, fmt.Sprintf("%d手詰: %s", problem.Type, problem.QImage))
+	}
+	altText := render.Truncate(strings.Join(lines, "\n"), lineAltTextMax)
+	return linebot.NewFlexMessage(altText, contents).WithQuickReplies(quickReplyItems(nil, 0)), nil
+}
+
+func problemBubble(problem *entity.Problem, key *datastore.Key, text string) *linebot.BubbleContainer {
+	return &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Hero: &linebot.ImageComponent{
+			Type:        linebot.FlexComponentTypeImage,
+			URL:         problem.QImage,
+			Size:        linebot.FlexImageSizeTypeFull,
+			AspectRatio: linebot.FlexImageAspectRatioType1to1,
+			AspectMode:  linebot.FlexImageAspectModeTypeFit,
+			Action:      linebot.NewURIAction("画像URL", problem.QImage),
+		},
+		Body: &linebot.BoxComponent{
+			Type:    linebot.FlexComponentTypeBox,
+			Layout:  linebot.FlexBoxLayoutTypeVertical,
+			Spacing: linebot.FlexComponentSpacingTypeSm,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{
+					Type:   linebot.FlexComponentTypeText,
+					Text:   text,
+					Size:   linebot.FlexTextSizeTypeXl,
+					Weight: linebot.FlexTextWeightTypeBold,
+				},
+				&linebot.TextComponent{
+					Type: linebot.FlexComponentTypeText,
+					Text: fmt.Sprintf("手数: %d手 / 難易度: %s", problem.Type, difficultyStars(problem.Difficulty)),
+					Size: linebot.FlexTextSizeTypeSm,
+				},
+			},
+		},
+		Footer: &linebot.BoxComponent{
+			Type:    linebot.FlexComponentTypeBox,
+			Layout:  linebot.FlexBoxLayoutTypeVertical,
+			Spacing: linebot.FlexComponentSpacingTypeSm,
+			Contents: []linebot.FlexComponent{
+				&linebot.ButtonComponent{
+					Type:   linebot.FlexComponentTypeButton,
+					Style:  linebot.FlexButtonStyleTypePrimary,
+					Action: linebot.NewPostbackAction("正解を見る", key.Encode()+":"+postbackAnswer, "", ""),
+				},
+				&linebot.ButtonComponent{
+					Type:   linebot.FlexComponentTypeButton,
+					Style:  linebot.FlexButtonStyleTypeSecondary,
+					Action: linebot.NewPostbackAction("ヒント", fmt.Sprintf("%s:%s:%d", key.Encode(), postbackHint, hintLevelPiece), "", ""),
+				},
+			},
+		},
+	}
+}
+
+func answerFlexMessage(problem *entity.Problem, key *datastore.Key, animation string) ([]linebot.SendingMessage, error) {
+	answer, _, err := generateAnswer(problem)
+	if err != nil {
+		return nil, err
+	}
+	text := fmt.Sprintf("正解は…\n%s です！", strings.Join(answer, " "))
+	contents := &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Hero: &linebot.ImageComponent{
+			Type:        linebot.FlexComponentTypeImage,
+			URL:         animation,
+			Size:        linebot.FlexImageSizeTypeFull,
+			AspectRatio: linebot.FlexImageAspectRatioType1to1,
+			AspectMode:  linebot.FlexImageAspectModeTypeFit,
+			Animated:    true,
+			Action:      linebot.NewURIAction("画像URL", problem.AImage),
+		},
+		Body: &linebot.BoxComponent{
+			Type:   linebot.FlexComponentTypeBox,
+			Layout: linebot.FlexBoxLayoutTypeVertical,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{
+					Type: linebot.FlexComponentTypeText,
+					Text: text,
+					Wrap: true,
+				},
+			},
+		},
+		Footer: &linebot.BoxComponent{
+			Type:   linebot.FlexComponentTypeBox,
+			Layout: linebot.FlexBoxLayoutTypeVertical,
+			Contents: []linebot.FlexComponent{
+				&linebot.ButtonComponent{
+					Type:   linebot.FlexComponentTypeButton,
+					Style:  linebot.FlexButtonStyleTypePrimary,
+					Action: linebot.NewMessageAction("もう1問！", fmt.Sprintf("%d手詰", problem.Type)),
+				},
+				&linebot.ButtonComponent{
+					Type:   linebot.FlexComponentTypeButton,
+					Style:  linebot.FlexButtonStyleTypeLink,
+					Height: linebot.FlexButtonHeightTypeSm,
+					Action: linebot.NewPostbackAction("問題を報告", key.Encode()+":"+postbackReport, "", ""),
+				},
+			},
+		},
+	}
+	return []linebot.SendingMessage{
+		linebot.NewFlexMessage(text, contents).WithQuickReplies(quickReplyItems(nil, 0)),
+	}, nil
+}
+
+func hintMessages(ctx context.Context, problem *entity.Problem, key *datastore.Key, level int, theme string) ([]linebot.SendingMessage, error) {
+	h, err := generateHint(ctx, problem, key, level, theme)
+	if err != nil {
+		return nil, err
+	}
+	messages := []linebot.SendingMessage{}
+	if h.Image != problem.QImage {
+		messages = append(messages, linebot.NewImageMessage(h.Image, h.Image))
+	}
+	text := fmt.Sprintf("ヒント%d: %s", h.Level, h.Text)
+	messages = append(messages, linebot.NewTextMessage(text).WithQuickReplies(quickReplyItems(key, h.Level+1)))
+	return messages, nil
+}
+
+// reportReasonMessage asks the reason of the report with quick reply chips
+func reportReasonMessage(key *datastore.Key) linebot.SendingMessage {
+	buttons := []*linebot.QuickReplyButton{}
+	for _, r := range reportReasons {
+		data := fmt.Sprintf("%s:%s:%s", key.Encode(), postbackReport, r.Reason)
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewPostbackAction(r.Label, data, "", r.Label)))
+	}
+	return linebot.NewTextMessage("報告の理由を選んでください").WithQuickReplies(linebot.NewQuickReplyItems(buttons...))
+}
+
+// quickReplyItems returns chips for new problems, and for the hint of the level and the answer if key is given
+func quickReplyItems(key *datastore.Key, hintLevel int) *linebot.QuickReplyItems {
+	buttons := []*linebot.QuickReplyButton{}
+	for _, text := range []string{"1手詰", "3手詰", "5手詰", "今日の問題"} {
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewMessageAction(text, text)))
+	}
+	if key != nil {
+		if hintLevel >= 1 && hintLevel <= hintLevelMax {
+			data := fmt.Sprintf("%s:%s:%d", key.Encode(), postbackHint, hintLevel)
+			buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewPostbackAction("ヒント", data, "", "ヒント")))
+		}
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewPostbackAction("答え", key.Encode()+":"+postbackAnswer, "", "答え")))
+	}
+	return linebot.NewQuickReplyItems(buttons...)
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+// errDailyPinned rolls back the reservation if another request has pinned the problem of the day
+var errDailyPinned = errors.New("problem of the day is already pinned")
+
+type dailyItem struct {
+	Date     string
+	Problems map[int]string
+}
+
+// today returns the date in JST
+func today() string {
+	return time.Now().In(jst).Format(entity.DateFormat)
+}
+
+// dailyHandler redirects "/daily/{date}/{type}" to the problem of the day,
+// and serves the calendar of the month ("/daily?month=YYYY-MM") otherwise
+func (s *server) dailyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/daily"), "/")
+	if path == "" {
+		s.renderCalendar(w, r)
+		return
+	}
+	p := strings.Split(path, "/")
+	if len(p) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	problemType := parseProblemType(p[1])
+	if problemType == nil {
+		http.NotFound(w, r)
+		return
+	}
+	_, key, err := s.dailyProblem(ctx, p[0], problemType)
+	if err != nil {
+		log.Infof(ctx, "failed to get daily problem: %v", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, "/play/"+key.Encode(), http.StatusFound)
+}
+
+func (s *server) renderCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	month := r.URL.Query().Get("month")
+	if month == "" {
+		month = today()[:len("2006-01")]
+	}
+	first, err := time.ParseInLocation("2006-01", month, jst)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	next := first.AddDate(0, 1, 0)
+
+	problems := map[string]map[int]string{}
+	iter := datastore.NewQuery(entity.KindNameDaily).
+		Filter("date >= ", first.Format(entity.DateFormat)).
+		Filter("date < ", next.Format(entity.DateFormat)).
+		Run(ctx)
+	for {
+		var daily entity.Daily
+		_, err := iter.Next(&daily)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			log.Errorf(ctx, "failed to fetch daily problems: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if problems[daily.Date] == nil {
+			problems[daily.Date] = map[int]string{}
+		}
+		problems[daily.Date][daily.Type] = "/daily/" + daily.Date + "/" + strconv.Itoa(daily.Type)
+	}
+	items := []*dailyItem{}
+	for d := first; d.Before(next); d = d.AddDate(0, 0, 1) {
+		date := d.Format(entity.DateFormat)
+		items = append(items, &dailyItem{Date: date, Problems: problems[date]})
+	}
+	if err := renderTemplate(w, "daily", map[string]interface{}{
+		"month": month,
+		"prev":  first.AddDate(0, -1, 0).Format("2006-01"),
+		"next":  next.Format("2006-01"),
+		"items": items,
+		"types": []int{1, 3, 5},
+	}); err != nil {
+		log.Errorf(ctx, "failed to render template: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// dailyProblem returns the problem of the day. A new problem is pinned if it is today and not pinned yet.
+func (s *server) dailyProblem(ctx context.Context, date string, problemType generator.Problem) (*entity.Problem, *datastore.Key, error) {
+	key := entity.DailyKey(ctx, date, problemType.Steps())
+	var daily entity.Daily
+	err := datastore.Get(ctx, key, &daily)
+	if err == datastore.ErrNoSuchEntity && date == today() {
+		// the problem is pinned in the transaction of the reservation, unless another request has pinned one in the meantime
+		_, _, _, err := s.reserveProblemWith(ctx, problemType, entity.ChannelDaily, date, func(ctx context.Context, problemKey *datastore.Key) error {
+			if err := datastore.Get(ctx, key, &daily); err == nil {
+				return errDailyPinned
+			} else if err != datastore.ErrNoSuchEntity {
+				return err
+			}
+			daily = entity.Daily{
+				Date:      date,
+				Type:      problemType.Steps(),
+				Problem:   problemKey,
+				CreatedAt: time.Now(),
+			}
+			_, err := datastore.Put(ctx, key, &daily)
+			return err
+		})
+		if err != nil && err != errDailyPinned {
+			return nil, nil, err
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	var problem entity.Problem
+	if err := datastore.Get(ctx, daily.Problem, &problem); err != nil {
+		return nil, nil, err
+	}
+	return &problem, daily.Problem, nil
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"time"
+
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+const feedEntries = 20
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Link    []atomLink   `xml:"link"`
+	Author  atomAuthor   `xml:"author"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+// feedHandler serves the Atom feed of the tweeted problems
+func (s *server) feedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	baseURL := "https://" + appengine.DefaultVersionHostname(ctx)
+	feed := &atomFeed{
+		Title: "詰将棋BOT",
+		ID:    baseURL + "/feed.atom",
+		Link: []atomLink{
+			{Href: baseURL + "/feed.atom", Rel: "self"},
+			{Href: baseURL + "/problems"},
+		},
+		Author: atomAuthor{Name: "tsumeshogi_bot"},
+	}
+	iter := datastore.NewQuery(entity.KindNameProblem).
+		Filter("tweeted_at > ", time.Time{}).
+		Order("-tweeted_at").
+		Limit(feedEntries).
+		Run(ctx)
+	for {
+		var problem entity.Problem
+		key, err := iter.Next(&problem)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			log.Errorf(ctx, "failed to fetch problems: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		answerURL := baseURL + "/answer/" + key.Encode()
+		title := fmt.Sprintf("%d手詰の問題", problem.Type)
+		feed.Entries = append(feed.Entries, &atomEntry{
+			Title:   title,
+			ID:      answerURL,
+			Updated: problem.TweetedAt.Format(time.RFC3339),
+			Link:    atomLink{Href: answerURL},
+			Content: atomContent{
+				Type: "html",
+				Body: fmt.Sprintf(
+					`<p>%s（%d手）</p><p><img src="%s" alt="%s"></p><p><a href="%s">正解はこちら</a></p>`,
+					title, problem.Type, html.EscapeString(problem.QImage), title, answerURL,
+				),
+			},
+		})
+	}
+	if len(feed.Entries) > 0 {
+		feed.Updated = feed.Entries[0].Updated
+	} else {
+		feed.Updated = time.Now().Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		log.Errorf(ctx, "failed to write feed: %v", err.Error())
+	}
+}
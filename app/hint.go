@@ -0,0 +1,118 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sugyan/shogi/format/csa"
+	"github.com/sugyan/shogi/util/image"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+// hint levels
+const (
+	hintLevelPiece = iota + 1
+	hintLevelSquare
+	hintLevelMove
+	hintLevelMax = hintLevelMove
+)
+
+type hint struct {
+	Level int
+	Text  string
+	Image string
+}
+
+// generateHint returns the hint of the level for the first move of the problem
+func generateHint(ctx context.Context, problem *entity.Problem, key *datastore.Key, level int, theme string) (*hint, error) {
+	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
+	if err != nil {
+		return nil, err
+	}
+	if len(record.Moves) == 0 {
+		return nil, errors.New("no moves in problem")
+	}
+	move := record.Moves[0]
+	verb := "動かします"
+	if render.IsDrop(move) {
+		verb = "打ちます"
+	}
+	h := &hint{
+		Level: level,
+		Image: problem.QImage,
+	}
+	switch level {
+	case hintLevelPiece:
+		h.Text = fmt.Sprintf("初手は%sを%s", render.PieceName(move.Piece), verb)
+	case hintLevelSquare:
+		h.Text = fmt.Sprintf("初手は%sに%sを%s", render.PositionName(move.Dst), render.PieceName(move.Piece), verb)
+		h.Image = "https://" + appengine.DefaultVersionHostname(ctx) + "/hint/" + key.Encode() + ".png"
+		if theme != "" {
+			h.Image += "?theme=" + url.QueryEscape(theme)
+		}
+	case hintLevelMove:
+		ms, err := record.State.MoveString(move)
+		if err != nil {
+			return nil, err
+		}
+		h.Text = fmt.Sprintf("初手は %s です", ms)
+	default:
+		return nil, fmt.Errorf("invalid hint level: %d", level)
+	}
+	return h, nil
+}
+
+// parseHintLevel returns the hint level from the string, or 0 if invalid
+func parseHintLevel(s string) int {
+	level, err := strconv.Atoi(s)
+	if err != nil || level < 1 || level > hintLevelMax {
+		return 0
+	}
+	return level
+}
+
+// hintImageHandler serves the problem image with the destination of the first move highlighted
+func (s *server) hintImageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	encodedKey := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/hint/"), ".png")
+	problem, _, err := getProblem(ctx, encodedKey)
+	if err != nil {
+		log.Infof(ctx, "failed to get problem: %v", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
+	if err != nil || len(record.Moves) == 0 {
+		log.Errorf(ctx, "failed to parse problem: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	style, err := s.styleOptions(r.URL.Query().Get("theme"), &record.Moves[0].Dst)
+	if err != nil {
+		log.Infof(ctx, "invalid theme: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	img, err := image.Generate(record.State, style)
+	if err != nil {
+		log.Errorf(ctx, "failed to generate image: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if err := png.Encode(w, img); err != nil {
+		log.Errorf(ctx, "failed to encode image: %v", err.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/sugyan/shogi"
+	"github.com/sugyan/shogi/format/csa"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+)
+
+// imageHandler serves the SVG image of the problem, or of the answer if "answer" parameter is given.
+// "theme" parameter overrides the default theme.
+func (s *server) imageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	name := strings.TrimPrefix(r.URL.Path, "/image/")
+	if !strings.HasSuffix(name, ".svg") {
+		http.NotFound(w, r)
+		return
+	}
+	problem, _, err := getProblem(ctx, strings.TrimSuffix(name, ".svg"))
+	if err != nil {
+		log.Infof(ctx, "failed to get problem: %v", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+	css, err := s.svgCSS(r.URL.Query().Get("theme"))
+	if err != nil {
+		log.Infof(ctx, "invalid theme: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := renderSVG(buf, problem, r.URL.Query().Get("answer") != "", css); err != nil {
+		log.Errorf(ctx, "failed to render image: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(buf.Bytes())
+}
+
+// renderSVG writes the SVG image of the problem, or of the mated position with the last move highlighted
+func renderSVG(buf *bytes.Buffer, problem *entity.Problem, answer bool, css string) error {
+	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
+	if err != nil {
+		return err
+	}
+	state := record.State
+	options := &render.SVGOptions{CSS: css}
+	if answer && len(record.Moves) > 0 {
+		state = state.Clone()
+		for _, move := range record.Moves {
+			state.Apply(move)
+		}
+		options.HighLights = []shogi.Position{record.Moves[len(record.Moves)-1].Dst}
+	}
+	return render.SVG(buf, state, options)
+}
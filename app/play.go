@@ -0,0 +1,263 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sugyan/shogi"
+	"github.com/sugyan/shogi/format/csa"
+	"github.com/sugyan/tsumeshogi-bot/render"
+	"github.com/sugyan/tsumeshogi-bot/rules"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+)
+
+type playPosition struct {
+	File int `json:"file"`
+	Rank int `json:"rank"`
+}
+
+type playMove struct {
+	// Src is nil for dropping a captured piece
+	Src   *playPosition `json:"src"`
+	Dst   playPosition  `json:"dst"`
+	Piece string        `json:"piece"`
+}
+
+type playRequest struct {
+	Moves []*playMove `json:"moves"`
+	// Started is the signed time when the page was served
+	Started *playStarted `json:"started"`
+}
+
+type playStarted struct {
+	Time      int64  `json:"time"`
+	Signature string `json:"sig"`
+}
+
+type playResponse struct {
+	Correct bool      `json:"correct"`
+	Reply   *playMove `json:"reply,omitempty"`
+	Solved  bool      `json:"solved"`
+	// Seconds since the page was served, which are not verified to be spent on solving, and the path of the shareable result page if solved
+	Seconds int    `json:"seconds,omitempty"`
+	Result  string `json:"result,omitempty"`
+}
+
+// playHandler serves the solving page on "/play/{key}" and validates the moves on "/play/{key}/move"
+func (s *server) playHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	encodedKey := strings.TrimPrefix(r.URL.Path, "/play/")
+	validate := strings.HasSuffix(encodedKey, "/move")
+	encodedKey = strings.TrimSuffix(encodedKey, "/move")
+	problem, _, err := getProblem(ctx, encodedKey)
+	if err != nil {
+		log.Infof(ctx, "failed to get problem: %v", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
+	if err != nil {
+		log.Errorf(ctx, "failed to parse problem: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !validate {
+		state, err := json.Marshal(render.NewStateJSON(record.State))
+		if err != nil {
+			log.Errorf(ctx, "failed to marshal state: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		started := time.Now().Unix()
+		if err := renderTemplate(w, "play", map[string]interface{}{
+			"title":       fmt.Sprintf("%d手詰の問題", problem.Type),
+			"url":         "https://" + appengine.DefaultVersionHostname(ctx) + r.URL.Path,
+			"image":       problem.QImage,
+			"key":         encodedKey,
+			"steps":       problem.Type,
+			"state":       template.JS(state),
+			"started":     &playStarted{Time: started, Signature: s.sign(encodedKey, "start:"+strconv.FormatInt(started, 10))},
+			"twitterSite": s.config.Card.TwitterSite,
+		}); err != nil {
+			log.Errorf(ctx, "failed to render template: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var req playRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, playRequestLimit)).Decode(&req); err != nil {
+		log.Infof(ctx, "failed to parse request: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	res := validateMoves(record.State, record.Moves, problem.Type, req.Moves)
+	if res.Solved && req.Started != nil &&
+		s.verifySignature(encodedKey, "start:"+strconv.FormatInt(req.Started.Time, 10), req.Started.Signature) {
+		res.Seconds = int(time.Since(time.Unix(req.Started.Time, 0)).Seconds())
+		if res.Seconds < 1 {
+			res.Seconds = 1
+		}
+		res.Result = s.resultPath(encodedKey, res.Seconds)
+	}
+	if err := writeJSON(w, res); err != nil {
+		log.Errorf(ctx, "failed to write response: %v", err.Error())
+	}
+}
+
+// limits of a request to validate the moves
+const (
+	playRequestLimit = 4096
+	// maximum number of the positions expanded to validate the moves off the answer
+	playSearchLimit = 1000
+)
+
+// validateMoves applies the moves so far to the position, and returns the reply of the defender
+// if the last move of the attacker is a check which still mates within the steps.
+// The moves following the answer, which the solver found when the problem was generated, are accepted without search,
+// and the other mating lines are accepted if the search within playSearchLimit finds the mate.
+func validateMoves(state *shogi.State, answer []*shogi.Move, steps int, moves []*playMove) *playResponse {
+	// the last move must be of the attacker
+	if len(moves) == 0 || len(moves)%2 == 0 || len(moves) > steps {
+		return &playResponse{}
+	}
+	board := rules.NewBoard(state)
+	search := &rules.Search{Limit: playSearchLimit}
+	// onAnswer is true while the moves follow the answer
+	onAnswer := true
+	for i, pm := range moves {
+		move, ok := parsePlayMove(pm)
+		if !ok {
+			return &playResponse{}
+		}
+		// number of the moves of the attacker left after the reply
+		remaining := (steps - i - 1) / 2
+		expected := answerMove(answer, i, onAnswer)
+		if i%2 == 1 {
+			// the replies of the defender must be the ones chosen by the server
+			if expected == nil {
+				expected = defenderReply(search, board, remaining+1)
+			}
+			if expected == nil || !move.Equal(expected) {
+				return &playResponse{}
+			}
+		} else if expected == nil || !move.Equal(expected) {
+			if !board.IsLegal(shogi.TurnFirst, move) {
+				return &playResponse{}
+			}
+			c := board.Clone()
+			c.Apply(shogi.TurnFirst, move)
+			if !c.InCheck(shogi.TurnSecond) {
+				return &playResponse{}
+			}
+			// rejected also if the search exceeds the limit
+			if ok, err := search.MateForced(c, remaining); err != nil || !ok {
+				return &playResponse{}
+			}
+		}
+		onAnswer = onAnswer && expected != nil && move.Equal(expected)
+		board.Apply(turnOf(i), move)
+	}
+	if board.IsMate(shogi.TurnSecond) {
+		return &playResponse{Correct: true, Solved: true}
+	}
+	reply := answerMove(answer, len(moves), onAnswer)
+	if reply == nil {
+		reply = defenderReply(search, board, (steps-len(moves))/2)
+	}
+	if reply == nil {
+		return &playResponse{}
+	}
+	return &playResponse{Correct: true, Reply: newPlayMove(reply)}
+}
+
+// defenderReply returns the reply which delays the mate the longest, as far as the search finds within its limit.
+// It depends only on the position and the search so far, so that validating the same moves again chooses the same reply.
+func defenderReply(search *rules.Search, board *rules.Board, remaining int) *rules.Move {
+	var (
+		reply   *rules.Move
+		longest = -1
+	)
+	for _, m := range board.LegalMoves(shogi.TurnSecond) {
+		c := board.Clone()
+		c.Apply(shogi.TurnSecond, m)
+		n := 1
+		for ; n <= remaining; n++ {
+			ok, err := search.CanMate(c, n)
+			if err != nil {
+				if reply == nil {
+					reply = m
+				}
+				return reply
+			}
+			if ok {
+				break
+			}
+		}
+		if n > longest {
+			reply, longest = m, n
+		}
+	}
+	return reply
+}
+
+// answerMove returns the i-th move of the answer if the moves so far follow the answer
+func answerMove(answer []*shogi.Move, i int, onAnswer bool) *rules.Move {
+	if !onAnswer || i >= len(answer) {
+		return nil
+	}
+	return newRulesMove(answer[i])
+}
+
+func turnOf(i int) shogi.Turn {
+	if i%2 == 0 {
+		return shogi.TurnFirst
+	}
+	return shogi.TurnSecond
+}
+
+func newRulesMove(move *shogi.Move) *rules.Move {
+	return &rules.Move{Src: move.Src, Dst: move.Dst, Piece: move.Piece}
+}
+
+func parsePlayMove(m *playMove) (*rules.Move, bool) {
+	if m == nil {
+		return nil, false
+	}
+	piece, ok := render.ParsePieceCode(m.Piece)
+	if !ok {
+		return nil, false
+	}
+	move := &rules.Move{
+		Dst:   shogi.Position{File: m.Dst.File, Rank: m.Dst.Rank},
+		Piece: piece,
+	}
+	if m.Src != nil {
+		move.Src = shogi.Position{File: m.Src.File, Rank: m.Src.Rank}
+	}
+	return move, true
+}
+
+func newPlayMove(move *rules.Move) *playMove {
+	m := &playMove{
+		Dst:   playPosition{File: move.Dst.File, Rank: move.Dst.Rank},
+		Piece: render.PieceCode(move.Piece),
+	}
+	if !move.IsDrop() {
+		m.Src = &playPosition{File: move.Src.File, Rank: move.Src.Rank}
+	}
+	return m
+}
@@ -6,32 +6,51 @@ import (
 	"net/http"
 
 	"github.com/sugyan/shogi/format/csa"
-
-	"github.com/sugyan/shogi/logic/problem/generator"
 	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
 	"google.golang.org/appengine"
 	"google.golang.org/appengine/datastore"
 	"google.golang.org/appengine/log"
 )
 
+// problemHandler serves a problem for the channel given by "consumer" parameter without consuming the stock on GET,
+// and reserves it for posting on the channel with "context" parameter on POST
 func (s *server) problemHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
 	t := r.URL.Query().Get("type")
+	problemType := parseProblemType(t)
+	if problemType == nil {
+		log.Errorf(ctx, "type '%v' is invalid", t)
+		http.NotFound(w, r)
+		return
+	}
 	var (
-		problem *entity.Problem
-		key     *datastore.Key
-		err     error
+		problem  *entity.Problem
+		key      *datastore.Key
+		repeated bool
+		err      error
 	)
-	switch t {
-	case "1":
-		problem, key, err = s.fetchProblem(ctx, generator.Type1)
-	case "3":
-		problem, key, err = s.fetchProblem(ctx, generator.Type3)
-	case "5":
-		problem, key, err = s.fetchProblem(ctx, generator.Type5)
+	consumer := r.URL.Query().Get("consumer")
+	if consumer == "" {
+		consumer = entity.ChannelAPI
+	}
+	if !entity.IsChannel(consumer) {
+		log.Infof(ctx, "consumer '%v' is invalid", consumer)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		problem, key, err = s.peekProblem(ctx, problemType, consumer)
+	case http.MethodPost:
+		problem, key, repeated, err = s.reserveProblem(ctx, problemType, consumer, r.URL.Query().Get("context"))
 	default:
-		log.Errorf(ctx, "type '%v' is invalid", t)
-		http.NotFound(w, r)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err == errNoProblem {
+		log.Warningf(ctx, "no problem of type %d", problemType.Steps())
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 		return
 	}
 	if err != nil {
@@ -39,6 +58,10 @@ func (s *server) problemHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	// served on the channel before because no unused problem is left
+	if repeated {
+		w.Header().Set("X-Problem-Repeated", "true")
+	}
 
 	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
 	if err != nil {
@@ -47,6 +70,18 @@ func (s *server) problemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get("format") == "text" {
+		buf := bytes.NewBufferString(fmt.Sprintf("%d手詰\n", problem.Type))
+		if err := render.Text(buf, record.State); err != nil {
+			log.Errorf(ctx, "failed to render problem: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+		return
+	}
+
 	buf := bytes.NewBufferString(fmt.Sprintf("'%s\n", key.Encode()))
 	convertOption := &csa.ConvertOption{
 		InitialState: csa.InitialStateOption1,
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+const problemsPerPage = 20
+
+type problemItem struct {
+	Key     string
+	Problem *entity.Problem
+}
+
+// problemsHandler serves the paginated list of problems filtered by "type", "difficulty" and "date" (YYYY-MM-DD in JST).
+// Only the problems already served are listed, so that the stock to be served is not revealed.
+func (s *server) problemsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	params := r.URL.Query()
+	query := datastore.NewQuery(entity.KindNameProblem).Order("-served_at")
+	if t := params.Get("type"); t != "" {
+		problemType := parseProblemType(t)
+		if problemType == nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		query = query.Filter("type = ", problemType.Steps())
+	}
+	if d := params.Get("difficulty"); d != "" {
+		difficulty, err := strconv.Atoi(d)
+		if err != nil || difficulty < 1 || difficulty > entity.DifficultyMax {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		query = query.Filter("difficulty = ", difficulty)
+	}
+	if d := params.Get("date"); d != "" {
+		date, err := time.ParseInLocation(entity.DateFormat, d, jst)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		query = query.
+			Filter("served_at >= ", date).
+			Filter("served_at < ", date.AddDate(0, 0, 1))
+	} else {
+		query = query.Filter("served_at > ", time.Time{})
+	}
+	if c := params.Get("cursor"); c != "" {
+		cursor, err := datastore.DecodeCursor(c)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		query = query.Start(cursor)
+	}
+
+	// the states are filtered here since served_at is the only property allowed an inequality filter
+	serving := map[string]bool{}
+	for _, state := range s.servingStates() {
+		serving[state] = true
+	}
+	// one more problem than a page is fetched to know whether the next page exists
+	items := make([]*problemItem, 0, problemsPerPage+1)
+	var cursor datastore.Cursor
+	iter := query.Run(ctx)
+	for len(items) <= problemsPerPage {
+		var problem entity.Problem
+		key, err := iter.Next(&problem)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			log.Errorf(ctx, "failed to fetch problems: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !serving[problem.State] {
+			continue
+		}
+		items = append(items, &problemItem{Key: key.Encode(), Problem: &problem})
+		if len(items) == problemsPerPage {
+			if cursor, err = iter.Cursor(); err != nil {
+				log.Errorf(ctx, "failed to get cursor: %v", err.Error())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	next := ""
+	if len(items) > problemsPerPage {
+		items = items[:problemsPerPage]
+		nextParams := url.Values{}
+		for k := range params {
+			nextParams.Set(k, params.Get(k))
+		}
+		nextParams.Set("cursor", cursor.String())
+		next = "/problems?" + nextParams.Encode()
+	}
+
+	difficulties := make([]int, entity.DifficultyMax)
+	for i := range difficulties {
+		difficulties[i] = i + 1
+	}
+	if err := renderTemplate(w, "problems", map[string]interface{}{
+		"items":        items,
+		"types":        []string{"1", "3", "5"},
+		"next":         next,
+		"type":         params.Get("type"),
+		"difficulty":   params.Get("difficulty"),
+		"date":         params.Get("date"),
+		"difficulties": difficulties,
+	}); err != nil {
+		log.Errorf(ctx, "failed to render template: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+type reportReason struct {
+	Reason string
+	Label  string
+}
+
+var reportReasons = []*reportReason{
+	{Reason: entity.ReportReasonYozume, Label: "余詰がある"},
+	{Reason: entity.ReportReasonWrongAnswer, Label: "正解が間違っている"},
+	{Reason: entity.ReportReasonOddPosition, Label: "不自然な局面"},
+	{Reason: entity.ReportReasonOther, Label: "その他"},
+}
+
+// reportReasonLabel returns the label of the reason, or empty string if invalid
+func reportReasonLabel(reason string) string {
+	for _, r := range reportReasons {
+		if r.Reason == reason {
+			return r.Label
+		}
+	}
+	return ""
+}
+
+// reportHandler records the report from the answer page on POST "/report/{key}"
+func (s *server) reportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	reason := r.FormValue("reason")
+	if reportReasonLabel(reason) == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	encodedKey := strings.TrimPrefix(r.URL.Path, "/report/")
+	key, err := datastore.DecodeKey(encodedKey)
+	if err != nil || key.Kind() != entity.KindNameProblem {
+		http.NotFound(w, r)
+		return
+	}
+	if err := s.reportProblem(ctx, key, reason, entity.ReportSourceWeb, webReporterID(r)); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			http.NotFound(w, r)
+			return
+		}
+		log.Errorf(ctx, "failed to report problem: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/answer/"+url.PathEscape(encodedKey)+"?reported=1", http.StatusSeeOther)
+}
+
+// webReporterID returns the hash of the IP address of the client, to identify reporters without storing the addresses
+func webReporterID(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	sum := sha256.Sum256([]byte(ip))
+	return hex.EncodeToString(sum[:16])
+}
+
+// reportProblem saves the report, and pauses the problem if the number of distinct reporters reaches the threshold.
+// Only the first report from each reporter is counted.
+func (s *server) reportProblem(ctx context.Context, key *datastore.Key, reason, source, reporterID string) error {
+	if reporterID == "" {
+		return errors.New("unknown reporter")
+	}
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var problem entity.Problem
+		if err := datastore.Get(ctx, key, &problem); err != nil {
+			return err
+		}
+		reportKey := entity.ReportKey(ctx, key, source, reporterID)
+		if err := datastore.Get(ctx, reportKey, &entity.Report{}); err == nil {
+			log.Infof(ctx, "problem %v is already reported by the reporter", key.IntID())
+			return nil
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		report := &entity.Report{
+			Reason:    reason,
+			Source:    source,
+			CreatedAt: time.Now(),
+		}
+		if _, err := datastore.Put(ctx, reportKey, report); err != nil {
+			return err
+		}
+		problem.Reports++
+		problem.UpdatedAt = time.Now()
+		threshold := s.config.Report.PauseThreshold
+		if threshold > 0 && problem.Reports >= threshold &&
+			(problem.State == entity.ProblemStatePending || problem.State == entity.ProblemStateApproved) {
+			if err := problem.SetState(entity.ProblemStatePaused); err != nil {
+				return err
+			}
+			log.Infof(ctx, "problem %v paused by %d reports", key.IntID(), problem.Reports)
+		}
+		_, err := datastore.Put(ctx, key, &problem)
+		return err
+	}, nil)
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/sugyan/shogi/format/csa"
+	"github.com/sugyan/shogi/util/image"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
+	"golang.org/x/image/font"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+)
+
+const (
+	cardFontSize   = 48
+	maxSolvingTime = 24 * 60 * 60
+)
+
+// resultHandler serves the shareable page "/result/{key}?t={seconds}&sig={signature}"
+// and its card image "/result/{key}.png?t={seconds}&sig={signature}".
+// The seconds are the time from serving the play page to the solving move, signed by the server.
+// The moves are validated without state, so the seconds are not a measured solving time: replaying the answer on a fresh page gives a second.
+func (s *server) resultHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	encodedKey := strings.TrimPrefix(r.URL.Path, "/result/")
+	cardImage := strings.HasSuffix(encodedKey, ".png")
+	encodedKey = strings.TrimSuffix(encodedKey, ".png")
+	t := r.URL.Query().Get("t")
+	if !s.verifySignature(encodedKey, "result:"+t, r.URL.Query().Get("sig")) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	seconds, err := strconv.Atoi(t)
+	if err != nil || seconds <= 0 || seconds > maxSolvingTime {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	problem, _, err := getProblem(ctx, encodedKey)
+	if err != nil {
+		log.Infof(ctx, "failed to get problem: %v", err.Error())
+		http.NotFound(w, r)
+		return
+	}
+
+	if cardImage {
+		buf := bytes.NewBuffer(nil)
+		if err := s.encodeCard(buf, problem, seconds); err != nil {
+			log.Errorf(ctx, "failed to generate card: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Write(buf.Bytes())
+		return
+	}
+
+	baseURL := "https://" + appengine.DefaultVersionHostname(ctx)
+	query := "?" + r.URL.RawQuery
+	if err := renderTemplate(w, "result", map[string]interface{}{
+		"title":       resultText(problem, seconds),
+		"url":         baseURL + r.URL.Path + query,
+		"image":       baseURL + "/result/" + url.PathEscape(encodedKey) + ".png" + query,
+		"play":        "/play/" + encodedKey,
+		"twitterSite": s.config.Card.TwitterSite,
+	}); err != nil {
+		log.Errorf(ctx, "failed to render template: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// resultPath returns the path of the result page with the signed seconds since the play page was served, or empty string if result cards are disabled
+func (s *server) resultPath(encodedKey string, seconds int) string {
+	if s.config.Card.Secret == "" {
+		return ""
+	}
+	t := strconv.Itoa(seconds)
+	return "/result/" + encodedKey + "?" + url.Values{
+		"t":   {t},
+		"sig": {s.sign(encodedKey, "result:"+t)},
+	}.Encode()
+}
+
+// sign returns the HMAC of the value for the problem with the secret of result cards
+func (s *server) sign(encodedKey, value string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Card.Secret))
+	mac.Write([]byte(encodedKey + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature returns true if the signature is of the value for the problem. It is false if no secret is configured.
+func (s *server) verifySignature(encodedKey, value, signature string) bool {
+	if s.config.Card.Secret == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(s.sign(encodedKey, value))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
+
+func resultText(problem *entity.Problem, seconds int) string {
+	return fmt.Sprintf("%d手詰を %d秒で解きました", problem.Type, seconds)
+}
+
+func (s *server) encodeCard(buf *bytes.Buffer, problem *entity.Problem, seconds int) error {
+	record, err := csa.Parse(bytes.NewBufferString(problem.CSA))
+	if err != nil {
+		return err
+	}
+	style, err := s.styleOptions("", nil)
+	if err != nil {
+		return err
+	}
+	board, err := image.Generate(record.State, style)
+	if err != nil {
+		return err
+	}
+	// Japanese text requires the configured font
+	lines := []string{fmt.Sprintf("%d手詰を", problem.Type), fmt.Sprintf("%d秒で解きました", seconds)}
+	if s.cardFace == nil {
+		lines = []string{fmt.Sprintf("Solved %d-move tsume", problem.Type), fmt.Sprintf("in %d sec", seconds)}
+	}
+	return png.Encode(buf, render.Card(board, lines, s.cardFace))
+}
+
+func loadFontFace(filename string, size float64) (font.Face, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := truetype.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	return truetype.NewFace(f, &truetype.Options{Size: size}), nil
+}
@@ -0,0 +1,224 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/urlfetch"
+)
+
+const slackActionIDAnswer = "answer"
+
+type slackBlock map[string]interface{}
+
+type slackMessage struct {
+	ResponseType    string       `json:"response_type,omitempty"`
+	ReplaceOriginal bool         `json:"replace_original,omitempty"`
+	Text            string       `json:"text"`
+	Blocks          []slackBlock `json:"blocks,omitempty"`
+}
+
+type slackInteraction struct {
+	Type        string `json:"type"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+func (s *server) slackCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	values, err := s.verifySlackRequest(r)
+	if err != nil {
+		log.Errorf(ctx, "failed to verify request: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var message *slackMessage
+	text := strings.TrimSuffix(strings.TrimSpace(values.Get("text")), "手詰")
+	if text == "" {
+		text = "3"
+	}
+	if problemType := parseProblemType(text); problemType != nil {
+		problem, key, repeated, err := s.reserveProblem(ctx, problemType, entity.ChannelSlack, values.Get("channel_id"))
+		switch {
+		case err == errNoProblem:
+			message = &slackMessage{
+				ResponseType: "ephemeral",
+				Text:         noProblemMessage,
+			}
+		case err != nil:
+			log.Errorf(ctx, "failed to fetch problem: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		default:
+			message = slackProblemMessage(problem, key, repeated)
+		}
+	} else {
+		message = &slackMessage{
+			ResponseType: "ephemeral",
+			Text:         fmt.Sprintf("使い方: %s [1|3|5]", values.Get("command")),
+		}
+	}
+	if err := writeJSON(w, message); err != nil {
+		log.Errorf(ctx, "failed to write response: %v", err.Error())
+	}
+}
+
+func (s *server) slackInteractionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	values, err := s.verifySlackRequest(r)
+	if err != nil {
+		log.Errorf(ctx, "failed to verify request: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(values.Get("payload")), &interaction); err != nil {
+		log.Errorf(ctx, "failed to parse payload: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	for _, action := range interaction.Actions {
+		if action.ActionID != slackActionIDAnswer {
+			continue
+		}
+		problem, _, err := getProblem(ctx, action.Value)
+		if err != nil {
+			log.Errorf(ctx, "failed to get problem: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		message, err := slackAnswerMessage(problem)
+		if err != nil {
+			log.Errorf(ctx, "failed to retrieve answer: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if err := postSlackResponse(ctx, interaction.ResponseURL, message); err != nil {
+			log.Errorf(ctx, "failed to post response: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// verifySlackRequest checks the signature of the request with the signing secret
+// and returns the parsed form values of the body
+func (s *server) verifySlackRequest(r *http.Request) (url.Values, error) {
+	// anyone could sign with an empty secret
+	if s.config.SlackBot.SigningSecret == "" {
+		return nil, errors.New("signing secret is not configured")
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if d := time.Since(time.Unix(sec, 0)); d > 5*time.Minute || d < -5*time.Minute {
+		return nil, errors.New("request timestamp is too old")
+	}
+	mac := hmac.New(sha256.New, []byte(s.config.SlackBot.SigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		return nil, errors.New("invalid signature")
+	}
+	return url.ParseQuery(string(body))
+}
+
+func slackProblemMessage(problem *entity.Problem, key *datastore.Key, repeated bool) *slackMessage {
+	text := fmt.Sprintf("%d手詰の問題です！", problem.Type)
+	if repeated {
+		text += "\n" + repeatedNotice
+	}
+	return &slackMessage{
+		ResponseType: "in_channel",
+		Text:         text,
+		Blocks: []slackBlock{
+			{
+				"type": "section",
+				"text": slackBlock{"type": "mrkdwn", "text": text},
+			},
+			{
+				"type":      "image",
+				"image_url": problem.QImage,
+				"alt_text":  text,
+			},
+			{
+				"type": "actions",
+				"elements": []slackBlock{
+					{
+						"type":      "button",
+						"action_id": slackActionIDAnswer,
+						"text":      slackBlock{"type": "plain_text", "text": "正解を見る"},
+						"value":     key.Encode(),
+					},
+				},
+			},
+		},
+	}
+}
+
+func slackAnswerMessage(problem *entity.Problem) (*slackMessage, error) {
+	answer, _, err := generateAnswer(problem)
+	if err != nil {
+		return nil, err
+	}
+	text := fmt.Sprintf("正解は…\n%s です！", strings.Join(answer, " "))
+	return &slackMessage{
+		ResponseType: "in_channel",
+		Text:         text,
+		Blocks: []slackBlock{
+			{
+				"type": "section",
+				"text": slackBlock{"type": "mrkdwn", "text": text},
+			},
+			{
+				"type":      "image",
+				"image_url": problem.AImage,
+				"alt_text":  text,
+			},
+		},
+	}, nil
+}
+
+func postSlackResponse(ctx context.Context, responseURL string, message *slackMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	res, err := urlfetch.Client(ctx).Post(responseURL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("response status: %s", res.Status)
+	}
+	return nil
+}
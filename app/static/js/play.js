@@ -0,0 +1,164 @@
+var Play = (function () {
+  'use strict';
+
+  var names = {
+    FU: '歩', KY: '香', KE: '桂', GI: '銀', KI: '金', KA: '角', HI: '飛', OU: '玉',
+    TO: 'と', NY: '杏', NK: '圭', NG: '全', UM: '馬', RY: '龍'
+  };
+  var promoted = { FU: 'TO', KY: 'NY', KE: 'NK', GI: 'NG', KA: 'UM', HI: 'RY' };
+  var unpromoted = { TO: 'FU', NY: 'KY', NK: 'KE', NG: 'GI', UM: 'KA', RY: 'HI' };
+  var handOrder = ['HI', 'KA', 'KI', 'GI', 'KE', 'KY', 'FU'];
+
+  var key, steps, state, moves = [], selected = null, started, startedAt, finished = false;
+
+  function cell(file, rank) {
+    return state.board[rank - 1][9 - file];
+  }
+
+  function setCell(file, rank, piece) {
+    state.board[rank - 1][9 - file] = piece;
+  }
+
+  function apply(move, first) {
+    var hands = state.hands[first ? 0 : 1];
+    var captured = cell(move.dst.file, move.dst.rank);
+    if (captured) {
+      var p = unpromoted[captured.piece] || captured.piece;
+      hands[p] = (hands[p] || 0) + 1;
+    }
+    if (move.src) {
+      setCell(move.src.file, move.src.rank, null);
+    } else {
+      hands[move.piece] -= 1;
+      if (hands[move.piece] === 0) {
+        delete hands[move.piece];
+      }
+    }
+    setCell(move.dst.file, move.dst.rank, { piece: move.piece, first: first });
+  }
+
+  function render() {
+    var board = document.getElementById('board');
+    board.innerHTML = '';
+    for (var rank = 1; rank <= 9; rank++) {
+      var tr = document.createElement('tr');
+      for (var file = 9; file >= 1; file--) {
+        var td = document.createElement('td');
+        var piece = cell(file, rank);
+        if (piece) {
+          td.textContent = names[piece.piece];
+          td.className = piece.first ? 'first' : 'second';
+        }
+        if (selected && selected.src && selected.src.file === file && selected.src.rank === rank) {
+          td.className += ' selected';
+        }
+        td.addEventListener('click', onClickCell.bind(null, file, rank));
+        tr.appendChild(td);
+      }
+      board.appendChild(tr);
+    }
+    renderHand(document.getElementById('hand-first'), state.hands[0], '☗', true);
+    renderHand(document.getElementById('hand-second'), state.hands[1], '☖', false);
+  }
+
+  function renderHand(elem, hand, mark, first) {
+    elem.innerHTML = '';
+    elem.appendChild(document.createTextNode(mark));
+    handOrder.forEach(function (p) {
+      if (!hand[p]) {
+        return;
+      }
+      var span = document.createElement('span');
+      span.textContent = names[p] + (hand[p] > 1 ? hand[p] : '');
+      if (first) {
+        if (selected && !selected.src && selected.piece === p) {
+          span.className = 'selected';
+        }
+        span.addEventListener('click', function () {
+          selected = { src: null, piece: p };
+          render();
+        });
+      }
+      elem.appendChild(span);
+    });
+  }
+
+  function onClickCell(file, rank) {
+    if (finished) {
+      return;
+    }
+    var piece = cell(file, rank);
+    if (piece && piece.first) {
+      selected = { src: { file: file, rank: rank }, piece: piece.piece };
+      render();
+      return;
+    }
+    if (!selected) {
+      return;
+    }
+    var move = { src: selected.src, dst: { file: file, rank: rank }, piece: selected.piece };
+    if (move.src && promoted[move.piece] && (move.src.rank <= 3 || rank <= 3) && window.confirm('成りますか？')) {
+      move.piece = promoted[move.piece];
+    }
+    selected = null;
+    play(move);
+  }
+
+  function play(move) {
+    var snapshot = JSON.stringify(state);
+    apply(move, true);
+    moves.push(move);
+    render();
+
+    var xhr = new XMLHttpRequest();
+    xhr.open('POST', '/play/' + key + '/move');
+    xhr.setRequestHeader('Content-Type', 'application/json');
+    xhr.onload = function () {
+      var res = JSON.parse(xhr.responseText);
+      if (!res.correct) {
+        moves.pop();
+        state = JSON.parse(snapshot);
+        render();
+        message('残念、不正解です。');
+        return;
+      }
+      if (res.solved) {
+        finished = true;
+        var seconds = res.seconds || Math.round((Date.now() - startedAt) / 1000);
+        message('正解です！ ' + seconds + '秒で解きました。');
+        if (res.result) {
+          share(res.result, seconds);
+        }
+        return;
+      }
+      apply(res.reply, false);
+      moves.push(res.reply);
+      render();
+      message('正解です。続けてください。');
+    };
+    xhr.send(JSON.stringify({ moves: moves, started: started }));
+  }
+
+  function share(path, seconds) {
+    var url = location.origin + path;
+    var text = steps + '手詰を ' + seconds + '秒で解きました';
+    var elem = document.getElementById('share');
+    elem.firstChild.href = 'https://twitter.com/intent/tweet?text=' + encodeURIComponent(text) + '&url=' + encodeURIComponent(url);
+    elem.style.display = '';
+  }
+
+  function message(text) {
+    document.getElementById('message').textContent = text;
+  }
+
+  return {
+    start: function (k, n, s, t) {
+      key = k;
+      steps = n;
+      state = s;
+      started = t;
+      startedAt = Date.now();
+      render();
+    }
+  };
+})();
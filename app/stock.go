@@ -0,0 +1,201 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/generate"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
+	"google.golang.org/appengine/taskqueue"
+	"google.golang.org/appengine/urlfetch"
+)
+
+// number of problems generated by a task
+const stockGenerateCount = 3
+
+// limit of the search of each problem
+const generateTimeout = time.Minute
+
+// interval of alerts for each type and channel, and of the generation tasks for each type
+const stockAlertInterval = time.Hour
+
+// interval of the stock checks for each type and channel
+const stockCheckInterval = time.Minute
+
+// notice for the problems served on the channel before
+const repeatedNotice = "※未出題の問題がないため、過去に出題した問題です"
+
+// message for the users when no problem can be served
+const noProblemMessage = "出題できる問題がありません。しばらくしてからお試しください"
+
+// errNoProblem is returned if no problem of the type can be served, or if every candidate is taken by concurrent requests
+var errNoProblem = errors.New("no problem to be served")
+
+// generator returns the generator of problems with the images saved in the bucket of the host
+func (s *server) generator() *generate.Generator {
+	return &generate.Generator{
+		Bucket:  s.config.Host,
+		Theme:   s.config.Theme.Default,
+		Timeout: generateTimeout,
+		Slots:   s.searchSlots,
+	}
+}
+
+// enqueueStockCheck enqueues the task of checkStock at most once in stockCheckInterval for each type and channel,
+// to keep the queries and the webhook off the request path
+func (s *server) enqueueStockCheck(ctx context.Context, problemType generator.Problem, channel string) error {
+	if s.config.Stock.AlertThreshold <= 0 {
+		return nil
+	}
+	item := &memcache.Item{
+		Key:        fmt.Sprintf("stock_check:%d:%s", problemType.Steps(), channel),
+		Value:      []byte{},
+		Expiration: stockCheckInterval,
+	}
+	if err := memcache.Add(ctx, item); err != nil {
+		if err == memcache.ErrNotStored {
+			return nil
+		}
+		return err
+	}
+	task := taskqueue.NewPOSTTask("/tasks/stock", url.Values{
+		"type":    {strconv.Itoa(problemType.Steps())},
+		"channel": {channel},
+	})
+	_, err := taskqueue.Add(ctx, task, "")
+	return err
+}
+
+// checkStock alerts to the webhook and triggers the generation
+// if the problems not served on the channel are fewer than the threshold
+func (s *server) checkStock(ctx context.Context, problemType generator.Problem, channel string) error {
+	threshold := s.config.Stock.AlertThreshold
+	if threshold <= 0 {
+		return nil
+	}
+	count := 0
+	for _, state := range s.servingStates() {
+		n, err := datastore.NewQuery(entity.KindNameProblem).
+			Filter("type = ", problemType.Steps()).
+			Filter("state = ", state).
+			Filter("unused = ", channel).
+			Count(ctx)
+		if err != nil {
+			return err
+		}
+		count += n
+	}
+	if count >= threshold {
+		return nil
+	}
+
+	// only once in the interval
+	item := &memcache.Item{
+		Key:        fmt.Sprintf("stock_alert:%d:%s", problemType.Steps(), channel),
+		Value:      []byte(strconv.Itoa(count)),
+		Expiration: stockAlertInterval,
+	}
+	if err := memcache.Add(ctx, item); err != nil {
+		if err == memcache.ErrNotStored {
+			return nil
+		}
+		return err
+	}
+	message := fmt.Sprintf("%d手詰の未使用の問題が残り%d問です (%s)", problemType.Steps(), count, channel)
+	log.Warningf(ctx, "%s", message)
+	if s.config.Stock.Generate {
+		task := taskqueue.NewPOSTTask("/tasks/generate", url.Values{
+			"type": {strconv.Itoa(problemType.Steps())},
+		})
+		// the task is named after the type and the interval, so that the channels share it
+		task.Name = fmt.Sprintf("generate-%d-%d", problemType.Steps(), time.Now().Unix()/int64(stockAlertInterval/time.Second))
+		if _, err := taskqueue.Add(ctx, task, ""); err != nil && err != taskqueue.ErrTaskAlreadyAdded {
+			return err
+		}
+		message += "\n問題を生成します"
+	}
+	if s.config.Stock.WebhookURL != "" {
+		if err := postWebhook(ctx, s.config.Stock.WebhookURL, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stockTaskHandler checks the stock of the type given by "type" parameter on the channel given by "channel" parameter
+func (s *server) stockTaskHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	problemType := parseProblemType(r.FormValue("type"))
+	channel := r.FormValue("channel")
+	if problemType == nil || !entity.IsChannel(channel) {
+		// responds OK not to be retried, which never fixes the parameters
+		log.Errorf(ctx, "invalid parameters: type=%q, channel=%q", r.FormValue("type"), channel)
+		return
+	}
+	if err := s.checkStock(ctx, problemType, channel); err != nil {
+		log.Errorf(ctx, "failed to check stock: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// generateTaskHandler generates problems of the type given by "type" parameter,
+// as many as "count" parameter or stockGenerateCount.
+// It responds OK for the errors which retrying never fixes, since the task queue retries the others.
+func (s *server) generateTaskHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	problemType := parseProblemType(r.FormValue("type"))
+	if problemType == nil {
+		log.Errorf(ctx, "invalid type: %q", r.FormValue("type"))
+		return
+	}
+	count := stockGenerateCount
+	if c, err := strconv.Atoi(r.FormValue("count")); err == nil && c > 0 {
+		count = c
+	}
+	for i := 0; i < count; i++ {
+		key, _, err := s.generator().Generate(ctx, problemType)
+		if err == generate.ErrTimeout {
+			// a timeout depends on the random position, and the retry would search the others again
+			log.Warningf(ctx, "failed to generate problem: %v", err.Error())
+			continue
+		}
+		if err != nil {
+			log.Errorf(ctx, "failed to generate problem: %v", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Infof(ctx, "problem %v saved", key.IntID())
+	}
+}
+
+// postWebhook posts the text to the webhook compatible with Slack incoming webhooks
+func postWebhook(ctx context.Context, webhookURL, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	res, err := urlfetch.Client(ctx).Post(webhookURL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook: %s", res.Status)
+	}
+	return nil
+}
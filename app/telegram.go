@@ -0,0 +1,168 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/urlfetch"
+)
+
+type telegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+	Callback *struct {
+		ID      string           `json:"id"`
+		Message *telegramMessage `json:"message"`
+		Data    string           `json:"data"`
+	} `json:"callback_query"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+type telegramInlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type telegramInlineKeyboardMarkup struct {
+	InlineKeyboard [][]telegramInlineKeyboardButton `json:"inline_keyboard"`
+}
+
+func (s *server) telegramHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	// requests from Telegram only, which are never verified without the secret token
+	secretToken := s.config.TelegramBot.SecretToken
+	if secretToken == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(secretToken)) != 1 {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var update telegramUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Errorf(ctx, "failed to parse request: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	log.Infof(ctx, "update: %v", update.UpdateID)
+	// responds OK even on errors, since Telegram retries the update and each retry would reserve another problem
+	if err := s.handleTelegramUpdate(ctx, &update); err != nil {
+		log.Errorf(ctx, "failed to handle update: %v", err.Error())
+	}
+}
+
+func (s *server) handleTelegramUpdate(ctx context.Context, update *telegramUpdate) error {
+	switch {
+	case update.Message != nil:
+		fields := strings.Fields(update.Message.Text)
+		if len(fields) == 0 {
+			return nil
+		}
+		// "/tsume3" or "/tsume3@botname"
+		command := strings.SplitN(fields[0], "@", 2)[0]
+		if !strings.HasPrefix(command, "/tsume") {
+			return nil
+		}
+		problemType := parseProblemType(strings.TrimPrefix(command, "/tsume"))
+		if problemType == nil {
+			return nil
+		}
+		problem, key, repeated, err := s.reserveProblem(ctx, problemType, entity.ChannelTelegram, strconv.FormatInt(update.Message.Chat.ID, 10))
+		if err == errNoProblem {
+			return s.callTelegram(ctx, "sendMessage", map[string]interface{}{
+				"chat_id": update.Message.Chat.ID,
+				"text":    noProblemMessage,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		return s.callTelegram(ctx, "sendPhoto", telegramProblemParams(update.Message.Chat.ID, problem, key, repeated))
+	case update.Callback != nil:
+		callback := update.Callback
+		if err := s.callTelegram(ctx, "answerCallbackQuery", map[string]interface{}{
+			"callback_query_id": callback.ID,
+		}); err != nil {
+			return err
+		}
+		if callback.Message == nil {
+			return nil
+		}
+		problem, _, err := getProblem(ctx, callback.Data)
+		if err != nil {
+			return err
+		}
+		answer, _, err := generateAnswer(problem)
+		if err != nil {
+			return err
+		}
+		return s.callTelegram(ctx, "editMessageCaption", map[string]interface{}{
+			"chat_id":    callback.Message.Chat.ID,
+			"message_id": callback.Message.MessageID,
+			"caption": fmt.Sprintf(
+				"%d手詰の問題です！\n正解は… <tg-spoiler>%s</tg-spoiler> です！",
+				problem.Type, html.EscapeString(strings.Join(answer, " ")),
+			),
+			"parse_mode": "HTML",
+		})
+	}
+	return nil
+}
+
+func telegramProblemParams(chatID int64, problem *entity.Problem, key *datastore.Key, repeated bool) map[string]interface{} {
+	caption := fmt.Sprintf("%d手詰の問題です！", problem.Type)
+	if repeated {
+		caption += "\n" + repeatedNotice
+	}
+	return map[string]interface{}{
+		"chat_id": chatID,
+		"photo":   problem.QImage,
+		"caption": caption,
+		"reply_markup": &telegramInlineKeyboardMarkup{
+			InlineKeyboard: [][]telegramInlineKeyboardButton{
+				{{Text: "正解を見る", CallbackData: key.Encode()}},
+			},
+		},
+	}
+}
+
+func (s *server) callTelegram(ctx context.Context, method string, params interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/%s", s.config.TelegramBot.Token, method)
+	res, err := urlfetch.Client(ctx).Post(endpoint, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("%s: %s", method, result.Description)
+	}
+	return nil
+}
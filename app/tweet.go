@@ -4,47 +4,70 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"image/jpeg"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/ChimeraCoder/anaconda"
+	"github.com/garyburd/go-oauth/oauth"
 	"github.com/sugyan/shogi/format/csa"
 	"github.com/sugyan/shogi/logic/problem/generator"
 	"github.com/sugyan/shogi/util/image"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
 	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
 	"google.golang.org/appengine/log"
 	"google.golang.org/appengine/urlfetch"
 )
 
-func (s *server) tweetHandler(w http.ResponseWriter, r *http.Request) {
-	// cron request only
-	if r.Header.Get("X-Appengine-Cron") != "true" {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
+// maximum length of alt text of media
+const twitterAltTextMax = 1000
 
+func (s *server) tweetHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
 	log.Infof(ctx, "tweet...")
-	if err := s.tweetProblem(ctx); err != nil {
+	// "daily" parameter specifies the type of the problem of the day
+	daily := parseProblemType(r.URL.Query().Get("daily"))
+	if err := s.tweetProblem(ctx, daily); err != nil {
 		log.Errorf(ctx, "failed to tweet: %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 }
 
-func (s *server) tweetProblem(ctx context.Context) error {
+func (s *server) tweetProblem(ctx context.Context, daily generator.Problem) error {
 	api := anaconda.NewTwitterApi(s.config.TwitterBot.AccessToken, s.config.TwitterBot.AccessTokenSecret)
 	api.HttpClient.Transport = &urlfetch.Transport{Context: ctx}
 
-	problemType := generator.Type3
-	// 5 steps!
-	if rand.Intn(5) == 0 {
-		problemType = generator.Type5
+	var (
+		problem *entity.Problem
+		key     *datastore.Key
+		err     error
+		title   string
+	)
+	if daily != nil {
+		problem, key, err = s.dailyProblem(ctx, today(), daily)
+		title = fmt.Sprintf("今日の%d手詰です！", daily.Steps())
+	} else {
+		problemType := generator.Type3
+		// 5 steps!
+		if rand.Intn(5) == 0 {
+			problemType = generator.Type5
+		}
+		// the tweet is not posted yet, so there is no context to record
+		var repeated bool
+		problem, key, repeated, err = s.reserveProblem(ctx, problemType, entity.ChannelTwitter, "")
+		title = fmt.Sprintf("%d手詰の問題です！", problemType.Steps())
+		if repeated {
+			title += "\n" + repeatedNotice
+		}
 	}
-	problem, key, err := s.fetchProblem(ctx, problemType)
 	if err != nil {
 		return err
 	}
@@ -52,7 +75,15 @@ func (s *server) tweetProblem(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	img, err := image.Generate(record.State, nil)
+	// the plain style of the library is kept unless the theme is configured
+	var style *image.StyleOptions
+	if s.config.Theme.Twitter != "" {
+		style, err = render.Style(s.config.Theme.Twitter, nil)
+		if err != nil {
+			return err
+		}
+	}
+	img, err := image.Generate(record.State, style)
 	if err != nil {
 		return err
 	}
@@ -67,6 +98,11 @@ func (s *server) tweetProblem(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	// alt text is best-effort, the problem is tweeted without it
+	description := render.Describe(record.State)
+	if err := s.createMediaMetadata(ctx, media.MediaIDString, render.Truncate(description.Japanese, twitterAltTextMax)); err != nil {
+		log.Warningf(ctx, "failed to create media metadata: %v", err.Error())
+	}
 	params := url.Values{}
 	params.Add("media_ids", media.MediaIDString)
 	URL, err := url.Parse("https://" + appengine.DefaultVersionHostname(ctx) + "/answer/" + key.Encode())
@@ -74,11 +110,93 @@ func (s *server) tweetProblem(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	status := fmt.Sprintf("%d手詰の問題です！\n正解はこちら → %s", problem.Type, URL.String())
+	status := fmt.Sprintf("%s\n正解はこちら → %s", title, URL.String())
 	tweet, err := api.PostTweet(status, params)
 	if err != nil {
 		return err
 	}
 	log.Infof(ctx, "tweeted: %v", tweet.IdStr)
+
+	// record the time for the feed, on the latest entity which may be reserved or reviewed in the meantime
+	tweetedAt := time.Now()
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var latest entity.Problem
+		if err := datastore.Get(ctx, key, &latest); err != nil {
+			return err
+		}
+		latest.TweetedAt = tweetedAt
+		_, err := datastore.Put(ctx, key, &latest)
+		return err
+	}, nil); err != nil {
+		return err
+	}
+	problem.TweetedAt = tweetedAt
+
+	// reply the animated answer in the thread
+	answer, _, err := generateAnswer(problem)
+	if err != nil {
+		return err
+	}
+	animation := bytes.NewBuffer(nil)
+	if err := encodeAnimation(animation, problem, ".gif", style); err != nil {
+		return err
+	}
+	chunked, err := api.UploadVideoInit(animation.Len(), "image/gif")
+	if err != nil {
+		return err
+	}
+	if err := api.UploadVideoAppend(chunked.MediaIDString, 0, base64.StdEncoding.EncodeToString(animation.Bytes())); err != nil {
+		return err
+	}
+	if _, err := api.UploadVideoFinalize(chunked.MediaIDString); err != nil {
+		return err
+	}
+	params = url.Values{}
+	params.Add("media_ids", chunked.MediaIDString)
+	params.Add("in_reply_to_status_id", tweet.IdStr)
+	status = fmt.Sprintf("@%s 正解は… %s です！", tweet.User.ScreenName, strings.Join(answer, " "))
+	reply, err := api.PostTweet(status, params)
+	if err != nil {
+		return err
+	}
+	log.Infof(ctx, "replied: %v", reply.IdStr)
+	return nil
+}
+
+// createMediaMetadata sets the alt text to the uploaded media
+func (s *server) createMediaMetadata(ctx context.Context, mediaID, altText string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"media_id": mediaID,
+		"alt_text": map[string]string{"text": altText},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", "https://upload.twitter.com/1.1/media/metadata/create.json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// JSON body is not included in the signature
+	client := &oauth.Client{
+		Credentials: oauth.Credentials{
+			Token:  s.config.TwitterBot.ConsumerKey,
+			Secret: s.config.TwitterBot.ConsumerSecret,
+		},
+	}
+	if err := client.SetAuthorizationHeader(req.Header, &oauth.Credentials{
+		Token:  s.config.TwitterBot.AccessToken,
+		Secret: s.config.TwitterBot.AccessTokenSecret,
+	}, req.Method, req.URL, nil); err != nil {
+		return err
+	}
+	res, err := urlfetch.Client(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to create media metadata: %s", res.Status)
+	}
 	return nil
 }
@@ -1,14 +1,42 @@
 package app
 
 import (
+	"encoding/json"
 	"html/template"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sugyan/tsumeshogi-bot/entity"
 )
 
+var templateFuncs = template.FuncMap{
+	"stars":        difficultyStars,
+	"reportReason": reportReasonLabel,
+	"jstDate":      formatDate,
+}
+
 func renderTemplate(w http.ResponseWriter, tmpl string, data interface{}) error {
-	t, err := template.ParseFiles("templates/" + tmpl + ".html")
+	t, err := template.New(tmpl + ".html").Funcs(templateFuncs).ParseFiles("templates/" + tmpl + ".html")
 	if err != nil {
 		return err
 	}
 	return t.Execute(w, data)
 }
+
+func writeJSON(w http.ResponseWriter, data interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(data)
+}
+
+func difficultyStars(d int) string {
+	if d < 1 || d > entity.DifficultyMax {
+		return ""
+	}
+	return strings.Repeat("★", d) + strings.Repeat("☆", entity.DifficultyMax-d)
+}
+
+// formatDate returns the date of the time in JST
+func formatDate(t time.Time) string {
+	return t.In(jst).Format(entity.DateFormat)
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sugyan/tsumeshogi-bot/worker"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/runtime"
+)
+
+// limit of generating and saving each problem in the worker
+const workerGenerateTimeout = 2 * generateTimeout
+
+// only one worker for each instance
+var (
+	workerMutex   sync.Mutex
+	workerStarted bool
+)
+
+// newWorker returns the background generation worker configured in config
+func (s *server) newWorker() *worker.Worker {
+	interval := time.Duration(s.config.Worker.Interval) * time.Minute
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	return &worker.Worker{
+		Generator: s.generator(),
+		Workers:   s.config.Worker.Workers,
+		Nice:      s.config.Worker.Nice,
+		Interval:  interval,
+		Timeout:   workerGenerateTimeout,
+	}
+}
+
+// startHandler starts the background generation worker if enabled, on the start request of the instance.
+// App Engine sends the start requests only to the instances of basic or manual scaling.
+func (s *server) startHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	if !s.config.Worker.Enabled {
+		return
+	}
+	workerMutex.Lock()
+	defer workerMutex.Unlock()
+	if workerStarted {
+		return
+	}
+	wk := s.newWorker()
+	if err := runtime.RunInBackground(ctx, func(ctx context.Context) {
+		log.Infof(ctx, "worker started")
+		wk.Run(ctx)
+	}); err != nil {
+		// not marked as started, so that the next start request retries
+		log.Errorf(ctx, "failed to start worker: %v", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	workerStarted = true
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// scopes of the endpoints
+const (
+	// ScopeProblem is required to fetch problems from "/problem"
+	ScopeProblem = "problem"
+	// ScopeAdmin is required for the admin pages
+	ScopeAdmin = "admin"
+	// ScopeCron is required for the scheduled jobs
+	ScopeCron = "cron"
+)
+
+// Verifier type authorizes the request by other means than API tokens, such as the headers set by the platform
+type Verifier func(r *http.Request, scope string) bool
+
+type token struct {
+	value  []byte
+	scopes map[string]bool
+}
+
+// Authenticator type authorizes requests by API tokens with scopes.
+// It depends on net/http only, so that it works outside App Engine as well.
+type Authenticator struct {
+	// DevMode allows all requests, for local development
+	DevMode bool
+	// Unauthorized is called for unauthorized requests. It responds with 401 if nil.
+	Unauthorized func(w http.ResponseWriter, r *http.Request, scope string)
+
+	tokens    []*token
+	verifiers []Verifier
+}
+
+// AddToken method registers the API token which is allowed the scopes
+func (a *Authenticator) AddToken(value string, scopes ...string) {
+	if value == "" {
+		return
+	}
+	t := &token{
+		value:  []byte(value),
+		scopes: map[string]bool{},
+	}
+	for _, scope := range scopes {
+		t.scopes[scope] = true
+	}
+	a.tokens = append(a.tokens, t)
+}
+
+// AddVerifier method registers the verifier tried after API tokens
+func (a *Authenticator) AddVerifier(v Verifier) {
+	a.verifiers = append(a.verifiers, v)
+}
+
+// Authorize method returns true if the request is allowed the scope
+func (a *Authenticator) Authorize(r *http.Request, scope string) bool {
+	if a.DevMode {
+		return true
+	}
+	if value := BearerToken(r); value != "" {
+		for _, t := range a.tokens {
+			if subtle.ConstantTimeCompare(t.value, []byte(value)) == 1 {
+				return t.scopes[scope]
+			}
+		}
+		return false
+	}
+	for _, v := range a.verifiers {
+		if v(r, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// Require method wraps the handler to serve only the requests allowed the scope
+func (a *Authenticator) Require(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.Authorize(r, scope) {
+			if a.Unauthorized != nil {
+				a.Unauthorized(w, r, scope)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer scope="`+scope+`"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// BearerToken function returns the token in "Authorization: Bearer <token>" header, or empty string
+func BearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
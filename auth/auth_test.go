@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newRequest(authorization string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	return r
+}
+
+// verifier allowing every request with the header
+func headerVerifier(r *http.Request, scope string) bool {
+	return r.Header.Get("X-Verified") == "true"
+}
+
+func TestBearerToken(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		expect string
+	}{
+		{"Bearer abc", "abc"},
+		{"bearer abc", "abc"},
+		{"BEARER abc ", "abc"},
+		{"Bearer ", ""},
+		{"Bearer", ""},
+		{"Basic abc", ""},
+		{"Bearerabc", ""},
+		{"", ""},
+	} {
+		if got := BearerToken(newRequest(c.header)); got != c.expect {
+			t.Errorf("BearerToken(%q) = %q, expected %q", c.header, got, c.expect)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	a := &Authenticator{}
+	a.AddToken("problem-token", ScopeProblem)
+	a.AddToken("admin-token", ScopeAdmin, ScopeCron)
+	// empty tokens are never registered
+	a.AddToken("", ScopeAdmin)
+	a.AddVerifier(headerVerifier)
+
+	verified := newRequest("")
+	verified.Header.Set("X-Verified", "true")
+	unknownVerified := newRequest("Bearer unknown")
+	unknownVerified.Header.Set("X-Verified", "true")
+
+	for _, c := range []struct {
+		name    string
+		request *http.Request
+		scope   string
+		expect  bool
+	}{
+		{"token with the scope", newRequest("Bearer problem-token"), ScopeProblem, true},
+		{"token without the scope", newRequest("Bearer problem-token"), ScopeAdmin, false},
+		{"token with multiple scopes", newRequest("Bearer admin-token"), ScopeCron, true},
+		{"lower case prefix", newRequest("bearer admin-token"), ScopeAdmin, true},
+		{"prefix of a token", newRequest("Bearer admin"), ScopeAdmin, false},
+		{"unknown token", newRequest("Bearer unknown"), ScopeProblem, false},
+		{"empty token", newRequest("Bearer "), ScopeAdmin, false},
+		{"no header", newRequest(""), ScopeProblem, false},
+		{"verified", verified, ScopeAdmin, true},
+		{"unknown token does not fall through to the verifiers", unknownVerified, ScopeAdmin, false},
+	} {
+		if got := a.Authorize(c.request, c.scope); got != c.expect {
+			t.Errorf("%s: Authorize = %v, expected %v", c.name, got, c.expect)
+		}
+	}
+
+	dev := &Authenticator{DevMode: true}
+	if !dev.Authorize(newRequest(""), ScopeAdmin) {
+		t.Error("DevMode does not allow the request")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+	a := &Authenticator{}
+	a.AddToken("cron-token", ScopeCron)
+
+	// allowed
+	w := httptest.NewRecorder()
+	a.Require(ScopeCron, ok)(w, newRequest("Bearer cron-token"))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("allowed request: %d %q", w.Code, w.Body.String())
+	}
+
+	// denied with 401 and the scope
+	w = httptest.NewRecorder()
+	a.Require(ScopeAdmin, ok)(w, newRequest("Bearer cron-token"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("denied request: %d, expected %d", w.Code, http.StatusUnauthorized)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != `Bearer scope="admin"` {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+	if w.Body.String() == "ok" {
+		t.Error("handler is called for the denied request")
+	}
+
+	// denied by the custom response
+	a.Unauthorized = func(w http.ResponseWriter, r *http.Request, scope string) {
+		http.Redirect(w, r, "/login?scope="+scope, http.StatusFound)
+	}
+	w = httptest.NewRecorder()
+	a.Require(ScopeAdmin, ok)(w, newRequest(""))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login?scope=admin" {
+		t.Errorf("custom response: %d %q", w.Code, w.Header().Get("Location"))
+	}
+}
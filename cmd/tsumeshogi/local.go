@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sugyan/shogi"
+	"github.com/sugyan/shogi/format/csa"
+	"github.com/sugyan/shogi/logic/problem/solver"
+	"github.com/sugyan/shogi/record"
+	"github.com/sugyan/shogi/util/image"
+	"github.com/sugyan/tsumeshogi-bot/render"
+)
+
+// readRecord reads CSA from the file, or stdin if the filename is empty
+func readRecord(filename string) (*record.Record, error) {
+	var r io.Reader = os.Stdin
+	if filename != "" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	return csa.Parse(r)
+}
+
+// answerState returns the mated position after the moves, and the destination of the last move
+func answerState(state *shogi.State, moves []*shogi.Move) (*shogi.State, *shogi.Position) {
+	state = state.Clone()
+	var last *shogi.Position
+	for _, move := range moves {
+		state.Apply(move)
+		dst := move.Dst
+		last = &dst
+	}
+	return state, last
+}
+
+func runShow(env *environment, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	answer := fs.Bool("answer", false, "show the mated position after the moves")
+	fs.Parse(args)
+
+	record, err := readRecord(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	state := record.State
+	if *answer {
+		state, _ = answerState(state, record.Moves)
+	}
+	return render.Text(os.Stdout, state)
+}
+
+func runSolve(env *environment, args []string) error {
+	fs := flag.NewFlagSet("solve", flag.ExitOnError)
+	fs.Parse(args)
+
+	record, err := readRecord(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	moves := solver.Solve(record.State)
+	if len(moves) == 0 {
+		return fmt.Errorf("no answer")
+	}
+	state := record.State.Clone()
+	answer := make([]string, 0, len(moves))
+	for _, move := range moves {
+		ms, err := state.MoveString(move)
+		if err != nil {
+			return err
+		}
+		answer = append(answer, ms)
+		state.Apply(move)
+	}
+	fmt.Println(strings.Join(answer, " "))
+	return nil
+}
+
+func runRender(env *environment, args []string) error {
+	defaultTheme := render.DefaultTheme
+	if env.config != nil && env.config.Theme.Default != "" {
+		defaultTheme = env.config.Theme.Default
+	}
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	format := fs.String("format", "png", "image format (png, svg, gif or apng)")
+	theme := fs.String("theme", defaultTheme, "theme of the image ("+strings.Join(render.Themes(), ", ")+")")
+	answer := fs.Bool("answer", false, "render the mated position after the moves")
+	out := fs.String("o", "", "output file. stdout if empty")
+	fs.Parse(args)
+
+	record, err := readRecord(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "gif", "apng":
+		// animate the answer, solving the position if the moves are not given
+		if len(record.Moves) == 0 {
+			record.Moves = solver.Solve(record.State)
+		}
+		style, err := render.Style(*theme, nil)
+		if err != nil {
+			return err
+		}
+		frames, err := render.Frames(record, style)
+		if err != nil {
+			return err
+		}
+		if *format == "gif" {
+			return render.EncodeGIF(w, frames)
+		}
+		return render.EncodeAPNG(w, frames)
+	case "png", "svg":
+		state := record.State
+		var highlight *shogi.Position
+		if *answer {
+			state, highlight = answerState(state, record.Moves)
+		}
+		if *format == "svg" {
+			css, err := render.SVGCSS(*theme)
+			if err != nil {
+				return err
+			}
+			options := &render.SVGOptions{CSS: css}
+			if highlight != nil {
+				options.HighLights = []shogi.Position{*highlight}
+			}
+			return render.SVG(w, state, options)
+		}
+		style, err := render.Style(*theme, highlight)
+		if err != nil {
+			return err
+		}
+		img, err := image.Generate(state, style)
+		if err != nil {
+			return err
+		}
+		return png.Encode(w, img)
+	}
+	return fmt.Errorf("invalid format: '%s'", *format)
+}
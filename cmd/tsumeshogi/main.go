@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sugyan/tsumeshogi-bot/config"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/appengine/remote_api"
+)
+
+type command struct {
+	usage string
+	// remote is true if the command accesses Datastore over remote_api
+	remote bool
+	// timeout is the default of -timeout
+	timeout time.Duration
+	run     func(env *environment, args []string) error
+}
+
+var commands = map[string]*command{
+	"generate":   {usage: "generate problems while the stock is short", remote: true, timeout: time.Minute, run: runGenerate},
+	"prune":      {usage: "delete low scored problems if the stock is full", remote: true, run: runPrune},
+	"delete-old": {usage: "delete old problems not served on any channel", remote: true, run: runDeleteOld},
+	"import":     {usage: "save the problems of CSA files", remote: true, run: runImport},
+	"export":     {usage: "write the problems as CSA", remote: true, run: runExport},
+	"stats":      {usage: "show the number of problems by type, state and channel", remote: true, run: runStats},
+	"migrate":    {usage: "migrate the problems saved in the old formats", remote: true, run: runMigrate},
+	"show":       {usage: "show the position of CSA as text", run: runShow},
+	"solve":      {usage: "solve the position of CSA", run: runSolve},
+	"render":     {usage: "render the position of CSA as an image", run: runRender},
+}
+
+type environment struct {
+	config *config.Config
+	ctx    context.Context
+}
+
+func main() {
+	defaultConfig := os.Getenv(config.EnvConfig)
+	if defaultConfig == "" {
+		defaultConfig = "app/config.toml"
+	}
+	var (
+		configPath string
+		timeout    time.Duration
+	)
+	flag.StringVar(&configPath, "config", defaultConfig, "path of the config file (or $"+config.EnvConfig+")")
+	flag.DurationVar(&timeout, "timeout", 0, "abort after the duration if positive (1m for generate if not given)")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	// the default of each command unless given
+	timeoutSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "timeout" {
+			timeoutSet = true
+		}
+	})
+	if !timeoutSet {
+		timeout = cmd.timeout
+	}
+	if timeout > 0 {
+		go func() {
+			time.Sleep(timeout)
+			log.Fatal("timeout")
+		}()
+	}
+
+	env := &environment{}
+	if cmd.remote {
+		c, err := config.LoadConfig(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.ApplyEnv()
+		ctx, err := remoteContext(c.Host)
+		if err != nil {
+			log.Fatal(err)
+		}
+		env.config = c
+		env.ctx = ctx
+	} else if c, err := config.LoadConfig(configPath); err == nil {
+		// the config is optional for the local commands
+		c.ApplyEnv()
+		env.config = c
+	} else if _, statErr := os.Stat(configPath); statErr == nil {
+		log.Printf("warning: failed to load %s, running without the config: %v", configPath, err)
+	}
+	if err := cmd.run(env, flag.Args()[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] <command> [arguments]\n\ncommands:\n", os.Args[0])
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s%s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+func remoteContext(host string) (context.Context, error) {
+	client, err := google.DefaultClient(context.Background(),
+		"https://www.googleapis.com/auth/appengine.apis",
+		"https://www.googleapis.com/auth/userinfo.email",
+		"https://www.googleapis.com/auth/cloud-platform",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return remote_api.NewRemoteContext(host, client)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine/datastore"
+)
+
+type migration func(ctx context.Context) error
+
+var migrations = map[string]migration{
+	"difficulty": migrateDifficulty,
+	"state":      migrateState,
+	"usage":      migrateUsage,
+	"served_at":  migrateServedAt,
+}
+
+// runMigrate runs the migrations of the names in the order
+func runMigrate(env *environment, args []string) error {
+	if len(args) == 0 {
+		names := []string{}
+		for name := range migrations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("usage: migrate <%s>...", strings.Join(names, "|"))
+	}
+	for _, name := range args {
+		if _, ok := migrations[name]; !ok {
+			return fmt.Errorf("unknown migration: '%s'", name)
+		}
+	}
+	for _, name := range args {
+		log.Printf("migrate %s", name)
+		if err := migrations[name](env.ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateProblems migrates each problem in its own transaction, so that the changes by the running app are not overwritten.
+// f returns the migrated properties and the description of the change, or nil if the problem is already migrated.
+func migrateProblems(ctx context.Context, f func(props datastore.PropertyList) (datastore.PropertyList, string)) error {
+	keys, err := datastore.NewQuery(entity.KindNameProblem).KeysOnly().GetAll(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var description string
+		err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+			var props datastore.PropertyList
+			if err := datastore.Get(ctx, key, &props); err != nil {
+				return err
+			}
+			migrated, d := f(props)
+			if migrated == nil {
+				return nil
+			}
+			description = d
+			_, err := datastore.Put(ctx, key, &migrated)
+			return err
+		}, nil)
+		if err == datastore.ErrNoSuchEntity {
+			// deleted in the meantime
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if description != "" {
+			log.Printf("%v: %s", key.IntID(), description)
+		}
+	}
+	return nil
+}
+
+// migrateDifficulty sets the difficulty of the problems saved before it was stored
+func migrateDifficulty(ctx context.Context) error {
+	return migrateProblems(ctx, func(props datastore.PropertyList) (datastore.PropertyList, string) {
+		score := 0
+		migrated := make(datastore.PropertyList, 0, len(props)+1)
+		for _, p := range props {
+			switch p.Name {
+			case "difficulty":
+				if d, ok := p.Value.(int64); ok && d != 0 {
+					return nil, ""
+				}
+				continue
+			case "score":
+				if s, ok := p.Value.(int64); ok {
+					score = int(s)
+				}
+			}
+			migrated = append(migrated, p)
+		}
+		difficulty := entity.Difficulty(score)
+		migrated = append(migrated, datastore.Property{Name: "difficulty", Value: int64(difficulty)})
+		return migrated, fmt.Sprintf("difficulty %d", difficulty)
+	})
+}
+
+// migrateState sets the review state of the problems saved before it was stored.
+// Problems in rotation are approved, and those with the "retired" flag are retired.
+func migrateState(ctx context.Context) error {
+	return migrateProblems(ctx, func(props datastore.PropertyList) (datastore.PropertyList, string) {
+		state := entity.ProblemStateApproved
+		migrated := make(datastore.PropertyList, 0, len(props))
+		for _, p := range props {
+			switch p.Name {
+			case "state":
+				return nil, ""
+			case "retired":
+				if retired, ok := p.Value.(bool); ok && retired {
+					state = entity.ProblemStateRetired
+				}
+				continue
+			}
+			migrated = append(migrated, p)
+		}
+		migrated = append(migrated, datastore.Property{Name: "state", Value: state})
+		return migrated, "state " + state
+	})
+}
+
+// migrateUsage replaces the "used" flag shared by all channels with the list of the channels not served yet.
+// Used problems are treated as used on all channels.
+func migrateUsage(ctx context.Context) error {
+	return migrateProblems(ctx, func(props datastore.PropertyList) (datastore.PropertyList, string) {
+		var used *bool
+		migrated := make(datastore.PropertyList, 0, len(props)+len(entity.Channels))
+		for _, p := range props {
+			if p.Name == "used" {
+				if u, ok := p.Value.(bool); ok {
+					used = &u
+				}
+				continue
+			}
+			migrated = append(migrated, p)
+		}
+		if used == nil {
+			return nil, ""
+		}
+		if !*used {
+			for _, channel := range entity.NewUnused() {
+				migrated = append(migrated, datastore.Property{Name: "unused", Value: channel, Multiple: true})
+			}
+		}
+		return migrated, fmt.Sprintf("used %v", *used)
+	})
+}
+
+// migrateServedAt sets the zero time as "served_at" of the problems saved before it was stored, to be selected by the time
+func migrateServedAt(ctx context.Context) error {
+	return migrateProblems(ctx, func(props datastore.PropertyList) (datastore.PropertyList, string) {
+		for _, p := range props {
+			if p.Name == "served_at" {
+				return nil, ""
+			}
+		}
+		return append(props, datastore.Property{Name: "served_at", Value: time.Time{}}), "saved"
+	})
+}
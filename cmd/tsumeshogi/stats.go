@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine/datastore"
+)
+
+var states = []string{
+	entity.ProblemStatePending,
+	entity.ProblemStateApproved,
+	entity.ProblemStatePaused,
+	entity.ProblemStateRejected,
+	entity.ProblemStateRetired,
+}
+
+func runStats(env *environment, args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "type\t")
+	for _, state := range states {
+		fmt.Fprintf(w, "%s\t", state)
+	}
+	// unused problems approved or waiting for review on each channel
+	for _, channel := range entity.Channels {
+		fmt.Fprintf(w, "unused(%s)\t", channel)
+	}
+	fmt.Fprintln(w)
+
+	for _, problemType := range []generator.Problem{generator.Type1, generator.Type3, generator.Type5} {
+		query := datastore.NewQuery(entity.KindNameProblem).Filter("type = ", problemType.Steps())
+		fmt.Fprintf(w, "%d\t", problemType.Steps())
+		for _, state := range states {
+			count, err := query.Filter("state = ", state).Count(env.ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%d\t", count)
+		}
+		for _, channel := range entity.Channels {
+			total := 0
+			for _, state := range []string{entity.ProblemStateApproved, entity.ProblemStatePending} {
+				count, err := query.Filter("state = ", state).Filter("unused = ", channel).Count(env.ctx)
+				if err != nil {
+					return err
+				}
+				total += count
+			}
+			fmt.Fprintf(w, "%d\t", total)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
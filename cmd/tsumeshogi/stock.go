@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/generate"
+	"google.golang.org/appengine/datastore"
+)
+
+// parseTypes returns the problem types for "1", "3", "5", or all types if empty
+func parseTypes(s string) ([]generator.Problem, error) {
+	switch s {
+	case "":
+		return []generator.Problem{generator.Type1, generator.Type3, generator.Type5}, nil
+	case "1":
+		return []generator.Problem{generator.Type1}, nil
+	case "3":
+		return []generator.Problem{generator.Type3}, nil
+	case "5":
+		return []generator.Problem{generator.Type5}, nil
+	}
+	return nil, fmt.Errorf("invalid type: '%s'", s)
+}
+
+func runGenerate(env *environment, args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	t := fs.String("type", "", "type of problems (1, 3 or 5). all types if empty")
+	n := fs.Int("n", 1, "maximum number of problems generated for each type")
+	search := fs.Duration("search", 20*time.Second, "limit of the search of each problem")
+	fs.Parse(args)
+
+	problemTypes, err := parseTypes(*t)
+	if err != nil {
+		return err
+	}
+	g := &generate.Generator{
+		Bucket:  env.config.Host,
+		Theme:   env.config.Theme.Default,
+		Timeout: *search,
+	}
+	for _, problemType := range problemTypes {
+		count, err := generate.CountStock(env.ctx, problemType)
+		if err != nil {
+			return err
+		}
+		log.Printf("type %d: %v", problemType.Steps(), count)
+		for i := 0; i < *n && count+i < entity.ProblemStockCount; i++ {
+			key, _, err := g.Generate(env.ctx, problemType)
+			if err != nil {
+				log.Printf("generate error %d: %v", problemType.Steps(), err)
+				break
+			}
+			log.Printf("problem %v (%s) saved", key.IntID(), key.Encode())
+		}
+	}
+	return nil
+}
+
+func runPrune(env *environment, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	t := fs.String("type", "", "type of problems (1, 3 or 5). all types if empty")
+	fs.Parse(args)
+
+	problemTypes, err := parseTypes(*t)
+	if err != nil {
+		return err
+	}
+	for _, problemType := range problemTypes {
+		count, err := generate.CountStock(env.ctx, problemType)
+		if err != nil {
+			return err
+		}
+		if count < entity.ProblemStockCount {
+			continue
+		}
+		if err := deleteLowScore(env, problemType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteLowScore deletes low scored problems waiting for review and not served on any channel. Approved ones are kept.
+func deleteLowScore(env *environment, problemType generator.Problem) error {
+	iter := datastore.NewQuery(entity.KindNameProblem).
+		Filter("type = ", problemType.Steps()).
+		Filter("state = ", entity.ProblemStatePending).
+		Order("score").
+		Run(env.ctx)
+	for i := 0; i < int(entity.ProblemStockCount*0.1); {
+		var p entity.Problem
+		key, err := iter.Next(&p)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !p.IsFresh() {
+			continue
+		}
+		i++
+		log.Printf("delete %v", key.IntID())
+		if err := p.Delete(env.ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runDeleteOld(env *environment, args []string) error {
+	fs := flag.NewFlagSet("delete-old", flag.ExitOnError)
+	days := fs.Int("days", 60, "delete problems created before the days")
+	interval := fs.Duration("interval", time.Second, "interval between deletions")
+	fs.Parse(args)
+
+	// used problems are kept for the archive
+	iter := datastore.NewQuery(entity.KindNameProblem).
+		Filter("created_at < ", time.Now().AddDate(0, 0, -*days)).
+		Run(env.ctx)
+	for {
+		var p entity.Problem
+		key, err := iter.Next(&p)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !p.IsFresh() {
+			continue
+		}
+		if err := p.Delete(env.ctx, key); err != nil {
+			return err
+		}
+		log.Printf("%v deleted.", key.IntID())
+		time.Sleep(*interval)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/sugyan/shogi"
+	"github.com/sugyan/shogi/logic/problem/solver"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/generate"
+	"github.com/sugyan/tsumeshogi-bot/rules"
+	"google.golang.org/appengine/datastore"
+)
+
+func runImport(env *environment, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	score := fs.Int("score", 0, "score of the problems")
+	fs.Parse(args)
+
+	g := &generate.Generator{
+		Bucket: env.config.Host,
+		Theme:  env.config.Theme.Default,
+	}
+	// read stdin if no files are given
+	filenames := fs.Args()
+	if len(filenames) == 0 {
+		filenames = []string{""}
+	}
+	for _, filename := range filenames {
+		record, err := readRecord(filename)
+		if filename == "" {
+			filename = "stdin"
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		// solve the position if the answer is not given
+		moves := record.Moves
+		if len(moves) == 0 {
+			moves = solver.Solve(record.State)
+		}
+		if err := verifyAnswer(record.State, moves); err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		key, problem, err := g.Save(env.ctx, record.State, moves, *score)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		log.Printf("%s: problem %v (%s) saved as %d steps", filename, key.IntID(), key.Encode(), problem.Type)
+	}
+	return nil
+}
+
+// verifyAnswer returns an error unless the moves are checks continuing to mate in 1, 3 or 5 steps,
+// as short as the answer of the solver
+func verifyAnswer(state *shogi.State, moves []*shogi.Move) error {
+	switch len(moves) {
+	case 1, 3, 5:
+	default:
+		return fmt.Errorf("invalid number of moves: %d", len(moves))
+	}
+	board := rules.NewBoard(state)
+	for i, move := range moves {
+		turn := shogi.TurnFirst
+		if i%2 == 1 {
+			turn = shogi.TurnSecond
+		}
+		m := &rules.Move{Src: move.Src, Dst: move.Dst, Piece: move.Piece}
+		if !board.IsLegal(turn, m) {
+			return fmt.Errorf("illegal move: %d", i+1)
+		}
+		board.Apply(turn, m)
+		if turn == shogi.TurnFirst && !board.InCheck(shogi.TurnSecond) {
+			return fmt.Errorf("not check: %d", i+1)
+		}
+	}
+	if !board.IsMate(shogi.TurnSecond) {
+		return errors.New("not mate")
+	}
+	if answer := solver.Solve(state); len(answer) != len(moves) {
+		return fmt.Errorf("mate in %d steps, but the solver answers %d", len(moves), len(answer))
+	}
+	return nil
+}
+
+func runExport(env *environment, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	t := fs.String("type", "", "type of problems (1, 3 or 5). all types if empty")
+	state := fs.String("state", "", "review state of problems. all states if empty")
+	dir := fs.String("out", "", "output directory for the files named by the keys. stdout if empty")
+	fs.Parse(args)
+
+	problemTypes, err := parseTypes(*t)
+	if err != nil {
+		return err
+	}
+	for _, problemType := range problemTypes {
+		query := datastore.NewQuery(entity.KindNameProblem).Filter("type = ", problemType.Steps())
+		if *state != "" {
+			query = query.Filter("state = ", *state)
+		}
+		iter := query.Run(env.ctx)
+		for {
+			var p entity.Problem
+			key, err := iter.Next(&p)
+			if err == datastore.Done {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if *dir == "" {
+				// records separated by "/" with the key as a comment
+				fmt.Printf("'%s\n%s/\n", key.Encode(), p.CSA)
+				continue
+			}
+			filename := filepath.Join(*dir, key.Encode()+".csa")
+			if err := ioutil.WriteFile(filename, []byte(p.CSA), 0644); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, filename)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,20 @@
 package config
 
-import "github.com/BurntSushi/toml"
+import (
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// environment variables for the commands
+const (
+	// EnvConfig is the path of the config file
+	EnvConfig = "TSUMESHOGI_CONFIG"
+	// EnvHost overrides "host"
+	EnvHost = "TSUMESHOGI_HOST"
+	// EnvTheme overrides "default" of "theme"
+	EnvTheme = "TSUMESHOGI_THEME"
+)
 
 // Config type
 type Config struct {
@@ -15,6 +29,51 @@ type Config struct {
 		AccessToken       string `toml:"access_token"`
 		AccessTokenSecret string `toml:"access_token_secret"`
 	} `toml:"twitter_bot"`
+	SlackBot struct {
+		SigningSecret string `toml:"signing_secret"`
+	} `toml:"slack_bot"`
+	TelegramBot struct {
+		Token       string `toml:"token"`
+		SecretToken string `toml:"secret_token"`
+	} `toml:"telegram_bot"`
+	Theme struct {
+		Default string `toml:"default"`
+		Twitter string `toml:"twitter"`
+		LineBot string `toml:"line_bot"`
+	} `toml:"theme"`
+	Card struct {
+		Font        string `toml:"font"`
+		Secret      string `toml:"secret"`
+		TwitterSite string `toml:"twitter_site"`
+	} `toml:"card"`
+	Curation struct {
+		Enabled bool `toml:"enabled"`
+	} `toml:"curation"`
+	Report struct {
+		PauseThreshold int `toml:"pause_threshold"`
+	} `toml:"report"`
+	Auth struct {
+		DevMode bool `toml:"dev_mode"`
+		Tokens  []struct {
+			Token  string   `toml:"token"`
+			Scopes []string `toml:"scopes"`
+		} `toml:"tokens"`
+	} `toml:"auth"`
+	Selection struct {
+		Default  string            `toml:"default"`
+		Channels map[string]string `toml:"channels"`
+	} `toml:"selection"`
+	Stock struct {
+		AlertThreshold int    `toml:"alert_threshold"`
+		WebhookURL     string `toml:"webhook_url"`
+		Generate       bool   `toml:"generate"`
+	} `toml:"stock"`
+	Worker struct {
+		Enabled  bool    `toml:"enabled"`
+		Workers  int     `toml:"workers"`
+		Nice     float64 `toml:"nice"`
+		Interval int     `toml:"interval"`
+	} `toml:"worker"`
 }
 
 // LoadConfig function
@@ -26,3 +85,13 @@ func LoadConfig(filepath string) (*Config, error) {
 	}
 	return &config, nil
 }
+
+// ApplyEnv method overrides the config with the environment variables
+func (c *Config) ApplyEnv() {
+	if host := os.Getenv(EnvHost); host != "" {
+		c.Host = host
+	}
+	if theme := os.Getenv(EnvTheme); theme != "" {
+		c.Theme.Default = theme
+	}
+}
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// constant values
+const (
+	KindNameDaily = "Daily"
+	DateFormat    = "2006-01-02"
+)
+
+// Daily type pins the problem of the day for each type
+type Daily struct {
+	Date      string         `datastore:"date"`
+	Type      int            `datastore:"type"`
+	Problem   *datastore.Key `datastore:"problem"`
+	CreatedAt time.Time      `datastore:"created_at"`
+}
+
+// DailyKey function returns the key of the daily problem such as "2006-01-02/3"
+func DailyKey(ctx context.Context, date string, problemType int) *datastore.Key {
+	return datastore.NewKey(ctx, KindNameDaily, fmt.Sprintf("%s/%d", date, problemType), 0, nil)
+}
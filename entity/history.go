@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// constant values
+const (
+	KindNameHistory       = "History"
+	HistoryActionGenerate = "generate"
+	HistoryActionDelete   = "delete"
+)
+
+// History type records the generations and the deletions of problems
+type History struct {
+	Action    string         `datastore:"action"`
+	Problem   *datastore.Key `datastore:"problem"`
+	Type      int            `datastore:"type"`
+	Score     int            `datastore:"score"`
+	CreatedAt time.Time      `datastore:"created_at"`
+}
+
+// RecordHistory function saves the action for the problem
+func RecordHistory(ctx context.Context, action string, key *datastore.Key, problem *Problem) error {
+	history := &History{
+		Action:    action,
+		Problem:   key,
+		Type:      problem.Type,
+		Score:     problem.Score,
+		CreatedAt: time.Now(),
+	}
+	_, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, KindNameHistory, nil), history)
+	return err
+}
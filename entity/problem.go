@@ -2,6 +2,7 @@ package entity
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/url"
 	"path"
@@ -14,23 +15,162 @@ import (
 
 // constant values
 const (
-	KindNameProblem   = "Problem"
-	ProblemStockCount = 100
+	KindNameProblem     = "Problem"
+	ProblemStockCount   = 100
+	DifficultyMax       = 5
+	DifficultyScoreStep = 20
+	// maximum number of entities deleted in a batch
+	deleteBatchSize = 500
 )
 
+// review states of problems
+const (
+	// ProblemStatePending is the state of generated problems waiting for review
+	ProblemStatePending = "pending"
+	// ProblemStateApproved is the state of reviewed problems to be served
+	ProblemStateApproved = "approved"
+	// ProblemStateRejected is the state of reviewed problems not to be served
+	ProblemStateRejected = "rejected"
+	// ProblemStateRetired is the state of problems withdrawn from rotation
+	ProblemStateRetired = "retired"
+	// ProblemStatePaused is the state of problems reported by users, waiting for review again
+	ProblemStatePaused = "paused"
+)
+
+// problemTransitions defines the states to which each state can change
+var problemTransitions = map[string][]string{
+	ProblemStatePending:  {ProblemStateApproved, ProblemStateRejected, ProblemStateRetired, ProblemStatePaused},
+	ProblemStateApproved: {ProblemStateRejected, ProblemStateRetired, ProblemStatePaused},
+	ProblemStateRejected: {ProblemStateApproved},
+	ProblemStateRetired:  {ProblemStateApproved},
+	ProblemStatePaused:   {ProblemStateApproved, ProblemStateRejected, ProblemStateRetired},
+}
+
 // Problem type
 type Problem struct {
-	CSA       string    `datastore:"csa,noindex"`
-	Type      int       `datastore:"type"`
-	Used      bool      `datastore:"used"`
-	QImage    string    `datastore:"q_image,noindex"`
-	AImage    string    `datastore:"a_image,noindex"`
-	Score     int       `datastore:"score"`
-	CreatedAt time.Time `datastore:"created_at"`
-	UpdatedAt time.Time `datastore:"updated_at"`
+	CSA        string    `datastore:"csa,noindex"`
+	Type       int       `datastore:"type"`
+	Unused     []string  `datastore:"unused"`
+	State      string    `datastore:"state"`
+	Reports    int       `datastore:"reports"`
+	QImage     string    `datastore:"q_image,noindex"`
+	AImage     string    `datastore:"a_image,noindex"`
+	Score      int       `datastore:"score"`
+	Difficulty int       `datastore:"difficulty"`
+	CreatedAt  time.Time `datastore:"created_at"`
+	UpdatedAt  time.Time `datastore:"updated_at"`
+	TweetedAt  time.Time `datastore:"tweeted_at"`
+	ServedAt   time.Time `datastore:"served_at"`
+}
+
+// Load method implements datastore.PropertyLoadSaver.
+// The problems saved before the review states are loaded as approved, or retired if the "retired" flag is set,
+// and those saved with the "used" flag shared by all channels are loaded as unused or used on all channels,
+// so that they are served and reviewed before the "state" and "usage" migrations.
+func (p *Problem) Load(props []datastore.Property) error {
+	var (
+		hasState bool
+		retired  bool
+		used     *bool
+	)
+	current := make([]datastore.Property, 0, len(props))
+	for _, prop := range props {
+		switch prop.Name {
+		case "state":
+			hasState = true
+		case "retired":
+			retired, _ = prop.Value.(bool)
+			continue
+		case "used":
+			if u, ok := prop.Value.(bool); ok {
+				used = &u
+			}
+			continue
+		}
+		current = append(current, prop)
+	}
+	if err := datastore.LoadStruct(p, current); err != nil {
+		return err
+	}
+	if !hasState {
+		p.State = ProblemStateApproved
+		if retired {
+			p.State = ProblemStateRetired
+		}
+	}
+	if used != nil && !*used && p.Unused == nil {
+		p.Unused = NewUnused()
+	}
+	return nil
+}
+
+// Save method implements datastore.PropertyLoadSaver
+func (p *Problem) Save() ([]datastore.Property, error) {
+	return datastore.SaveStruct(p)
+}
+
+// Difficulty function returns the level from 1 to DifficultyMax derived from the score
+func Difficulty(score int) int {
+	d := score/DifficultyScoreStep + 1
+	if d < 1 {
+		return 1
+	}
+	if d > DifficultyMax {
+		return DifficultyMax
+	}
+	return d
 }
 
-// Delete method
+// SetState method changes the review state of the problem if the transition is allowed
+func (p *Problem) SetState(state string) error {
+	for _, s := range problemTransitions[p.State] {
+		if s == state {
+			p.State = state
+			p.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid state transition: '%s' to '%s'", p.State, state)
+}
+
+// NewUnused function returns the list of all channels, for a problem not served yet
+func NewUnused() []string {
+	return append([]string{}, Channels...)
+}
+
+// IsUnused method returns true if the problem is not served on the channel yet
+func (p *Problem) IsUnused(channel string) bool {
+	for _, c := range p.Unused {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFresh method returns true if the problem is not served on any channel yet
+func (p *Problem) IsFresh() bool {
+	for _, c := range Channels {
+		if !p.IsUnused(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// MarkUsed method removes the channel from the unused channels
+func (p *Problem) MarkUsed(channel string) {
+	unused := make([]string, 0, len(p.Unused))
+	for _, c := range p.Unused {
+		if c != channel {
+			unused = append(unused, c)
+		}
+	}
+	p.Unused = unused
+	p.UpdatedAt = time.Now()
+}
+
+// Delete method deletes the problem with its images, and the entities under it such as reports and usages
 func (p *Problem) Delete(ctx context.Context, key *datastore.Key) error {
 	for _, imageURL := range []string{p.QImage, p.AImage} {
 		if imageURL == "" {
@@ -44,7 +184,22 @@ func (p *Problem) Delete(ctx context.Context, key *datastore.Key) error {
 			}
 		}
 	}
-	return datastore.Delete(ctx, key)
+	// the kindless ancestor query includes the problem itself
+	keys, err := datastore.NewQuery("").Ancestor(key).KeysOnly().GetAll(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > deleteBatchSize {
+			n = deleteBatchSize
+		}
+		if err := datastore.DeleteMulti(ctx, keys[:n]); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return RecordHistory(ctx, HistoryActionDelete, key, p)
 }
 
 func deleteImage(ctx context.Context, imageURL string) error {
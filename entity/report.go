@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// constant values
+const (
+	KindNameReport = "Report"
+)
+
+// reasons of reports
+const (
+	// ReportReasonYozume is the reason for problems which have another solution (余詰)
+	ReportReasonYozume = "yozume"
+	// ReportReasonWrongAnswer is the reason for problems whose answer is wrong
+	ReportReasonWrongAnswer = "wrong_answer"
+	// ReportReasonOddPosition is the reason for problems whose position is unnatural
+	ReportReasonOddPosition = "odd_position"
+	// ReportReasonOther is the reason for the others
+	ReportReasonOther = "other"
+)
+
+// sources of reports
+const (
+	ReportSourceLineBot = "line_bot"
+	ReportSourceWeb     = "web"
+)
+
+// Report type is a report from users against the problem.
+// The problem is its parent, and the key name identifies the reporter so that each reporter is counted once.
+type Report struct {
+	Reason    string    `datastore:"reason"`
+	Source    string    `datastore:"source"`
+	CreatedAt time.Time `datastore:"created_at"`
+}
+
+// ReportKey function returns the key of the report against the problem by the reporter of the source
+func ReportKey(ctx context.Context, problemKey *datastore.Key, source, reporterID string) *datastore.Key {
+	return datastore.NewKey(ctx, KindNameReport, source+":"+reporterID, 0, problemKey)
+}
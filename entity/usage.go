@@ -0,0 +1,122 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// constant values
+const (
+	KindNameUsage = "Usage"
+)
+
+// channels consuming problems
+const (
+	ChannelTwitter  = "twitter"
+	ChannelLineBot  = "line_bot"
+	ChannelSlack    = "slack"
+	ChannelTelegram = "telegram"
+	ChannelDaily    = "daily"
+	ChannelAPI      = "api"
+)
+
+// ErrProblemTaken is returned by Reserve if the problem is already used on the channel or withdrawn
+var ErrProblemTaken = errors.New("problem is already taken")
+
+// Channels is the list of all channels.
+// Problems saved before a channel is added are treated as used on it.
+var Channels = []string{
+	ChannelTwitter,
+	ChannelLineBot,
+	ChannelSlack,
+	ChannelTelegram,
+	ChannelDaily,
+	ChannelAPI,
+}
+
+// IsChannel function returns true if the name is one of Channels
+func IsChannel(name string) bool {
+	for _, c := range Channels {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage type records that the problem is served on the channel. The problem is its parent.
+type Usage struct {
+	Channel string `datastore:"channel"`
+	// ContextID identifies where the problem is served in the channel, such as the chat ID
+	ContextID string    `datastore:"context_id"`
+	CreatedAt time.Time `datastore:"created_at"`
+}
+
+// RecordUsage function saves the usage of the problem on the channel
+func RecordUsage(ctx context.Context, key *datastore.Key, channel, contextID string) error {
+	usage := &Usage{
+		Channel:   channel,
+		ContextID: contextID,
+		CreatedAt: time.Now(),
+	}
+	_, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, KindNameUsage, key), usage)
+	return err
+}
+
+// Reserve function marks the problem as used on the channel and records the usage atomically.
+// It fails with ErrProblemTaken if the state of the problem is not one of the states,
+// or if requireUnused is true and another request has used the problem on the channel.
+func Reserve(ctx context.Context, key *datastore.Key, channel, contextID string, requireUnused bool, states []string) (*Problem, error) {
+	return ReserveWith(ctx, key, channel, contextID, requireUnused, states, nil)
+}
+
+// ReserveWith function is Reserve which also calls f with the key of the problem in the same transaction across entity groups.
+// The reservation is rolled back if f returns an error.
+func ReserveWith(ctx context.Context, key *datastore.Key, channel, contextID string, requireUnused bool, states []string, f func(ctx context.Context, key *datastore.Key) error) (*Problem, error) {
+	var options *datastore.TransactionOptions
+	if f != nil {
+		options = &datastore.TransactionOptions{XG: true}
+	}
+	var problem Problem
+	err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := datastore.Get(ctx, key, &problem); err != nil {
+			return err
+		}
+		allowed := false
+		for _, state := range states {
+			if problem.State == state {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ErrProblemTaken
+		}
+		if problem.IsUnused(channel) {
+			problem.MarkUsed(channel)
+		} else if requireUnused {
+			return ErrProblemTaken
+		}
+		problem.ServedAt = time.Now()
+		if _, err := datastore.Put(ctx, key, &problem); err != nil {
+			return err
+		}
+		if err := RecordUsage(ctx, key, channel, contextID); err != nil {
+			return err
+		}
+		if f != nil {
+			return f(ctx, key)
+		}
+		return nil
+	}, options)
+	if err == datastore.ErrConcurrentTransaction {
+		return nil, ErrProblemTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &problem, nil
+}
@@ -0,0 +1,129 @@
+package entity
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/aetest"
+	"google.golang.org/appengine/datastore"
+)
+
+var servingStates = []string{ProblemStateApproved, ProblemStatePending}
+
+func newTestInstance(t *testing.T) aetest.Instance {
+	inst, err := aetest.NewInstance(&aetest.Options{StronglyConsistentDatastore: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inst
+}
+
+func putTestProblem(t *testing.T, inst aetest.Instance, state string) *datastore.Key {
+	req, err := inst.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := appengine.NewContext(req)
+	key, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, KindNameProblem, nil), &Problem{
+		Type:      3,
+		Unused:    NewUnused(),
+		State:     state,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestReserveConcurrently(t *testing.T) {
+	inst := newTestInstance(t)
+	defer inst.Close()
+	key := putTestProblem(t, inst, ProblemStateApproved)
+
+	const n = 20
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+		errs     []error
+	)
+	for i := 0; i < n; i++ {
+		req, err := inst.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Reserve(appengine.NewContext(req), key, ChannelLineBot, "", true, servingStates)
+			mu.Lock()
+			defer mu.Unlock()
+			switch err {
+			case nil:
+				reserved++
+			case ErrProblemTaken:
+			default:
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		t.Error(err)
+	}
+	if reserved != 1 {
+		t.Fatalf("reserved %d times, expected once", reserved)
+	}
+
+	req, err := inst.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := appengine.NewContext(req)
+	var problem Problem
+	if err := datastore.Get(ctx, key, &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.IsUnused(ChannelLineBot) {
+		t.Error("problem is still unused on the channel")
+	}
+	if !problem.IsUnused(ChannelTwitter) {
+		t.Error("problem is used on the other channel")
+	}
+	usages, err := datastore.NewQuery(KindNameUsage).Ancestor(key).Count(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usages != 1 {
+		t.Errorf("%d usages recorded, expected 1", usages)
+	}
+}
+
+func TestReserveStates(t *testing.T) {
+	inst := newTestInstance(t)
+	defer inst.Close()
+
+	for _, c := range []struct {
+		state  string
+		states []string
+		err    error
+	}{
+		{ProblemStateApproved, servingStates, nil},
+		{ProblemStatePending, servingStates, nil},
+		{ProblemStatePending, []string{ProblemStateApproved}, ErrProblemTaken},
+		{ProblemStatePaused, servingStates, ErrProblemTaken},
+		{ProblemStateRetired, servingStates, ErrProblemTaken},
+	} {
+		key := putTestProblem(t, inst, c.state)
+		req, err := inst.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Reserve(appengine.NewContext(req), key, ChannelTwitter, "", true, c.states); err != c.err {
+			t.Errorf("state %s in %v: got %v, expected %v", c.state, c.states, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package generate
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"image/png"
+	"io"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/sugyan/shogi"
+	"github.com/sugyan/shogi/format/csa"
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/shogi/logic/problem/solver"
+	"github.com/sugyan/shogi/record"
+	"github.com/sugyan/shogi/util/image"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/render"
+	"google.golang.org/appengine/datastore"
+)
+
+// ErrTimeout is returned if the search of a problem exceeds the timeout
+var ErrTimeout = errors.New("generate: timeout")
+
+// Generator type generates problems and saves them with their images
+type Generator struct {
+	// Bucket is the name of the Cloud Storage bucket for images
+	Bucket string
+	// Theme is the theme of images
+	Theme string
+	// Timeout limits the search of each problem if positive
+	Timeout time.Duration
+	// Slots limits the searches running at once if not nil. A slot is released when the search finishes even after the timeout,
+	// so that the searches left running never pile up.
+	Slots chan struct{}
+}
+
+// Generate method generates a problem of the type, and saves it with its images
+func (g *Generator) Generate(ctx context.Context, problemType generator.Problem) (*datastore.Key, *entity.Problem, error) {
+	q, a, score, err := g.search(ctx, problemType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g.Save(ctx, q, a, score)
+}
+
+// search generates a problem and solves it until the timeout or the context is done.
+// The search cannot be interrupted, so it is left running in the background in that case, holding its slot of Slots.
+func (g *Generator) search(ctx context.Context, problemType generator.Problem) (*shogi.State, []*shogi.Move, int, error) {
+	type result struct {
+		q     *shogi.State
+		a     []*shogi.Move
+		score int
+	}
+	if g.Slots != nil {
+		select {
+		case g.Slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, nil, 0, ctx.Err()
+		}
+	}
+	done := make(chan *result, 1)
+	go func() {
+		if g.Slots != nil {
+			defer func() { <-g.Slots }()
+		}
+		q, score := generator.Generate(problemType)
+		done <- &result{q: q, a: solver.Solve(q), score: score}
+	}()
+	var timeout <-chan time.Time
+	if g.Timeout > 0 {
+		timer := time.NewTimer(g.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case r := <-done:
+		return r.q, r.a, r.score, nil
+	case <-ctx.Done():
+		return nil, nil, 0, ctx.Err()
+	case <-timeout:
+		return nil, nil, 0, ErrTimeout
+	}
+}
+
+// Save method saves the problem of the position and the answer moves with its images
+func (g *Generator) Save(ctx context.Context, q *shogi.State, a []*shogi.Move, score int) (*datastore.Key, *entity.Problem, error) {
+	if len(a) == 0 {
+		return nil, nil, errors.New("no answer moves")
+	}
+	record := &record.Record{
+		State: q,
+		Moves: a,
+	}
+
+	// generate image
+	var qImage, aImage string
+	{
+		s := q.Clone()
+		b, err := generatePNG(s, nil, g.Theme)
+		if err != nil {
+			return nil, nil, err
+		}
+		qImage, err = g.uploadImage(ctx, b, "png")
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, m := range a {
+			s.Apply(m)
+		}
+		b, err = generatePNG(s, &a[len(a)-1].Dst, g.Theme)
+		if err != nil {
+			return nil, nil, err
+		}
+		aImage, err = g.uploadImage(ctx, b, "png")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// save
+	problem := &entity.Problem{
+		CSA: record.ConvertToString(csa.NewConverter(&csa.ConvertOption{
+			InitialState: csa.InitialStateOption2,
+		})),
+		Type:       len(a),
+		Unused:     entity.NewUnused(),
+		State:      entity.ProblemStatePending,
+		QImage:     qImage,
+		AImage:     aImage,
+		Score:      score,
+		Difficulty: entity.Difficulty(score),
+		CreatedAt:  time.Now(),
+	}
+	key, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, entity.KindNameProblem, nil), problem)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := entity.RecordHistory(ctx, entity.HistoryActionGenerate, key, problem); err != nil {
+		return nil, nil, err
+	}
+	return key, problem, nil
+}
+
+// CountStock function returns the number of the unused problems of the type approved or waiting for review,
+// on the channel which has the fewest
+func CountStock(ctx context.Context, problemType generator.Problem) (int, error) {
+	count := -1
+	for _, channel := range entity.Channels {
+		c := 0
+		for _, state := range []string{entity.ProblemStateApproved, entity.ProblemStatePending} {
+			n, err := datastore.NewQuery(entity.KindNameProblem).
+				Filter("type = ", problemType.Steps()).
+				Filter("state = ", state).
+				Filter("unused = ", channel).
+				Count(ctx)
+			if err != nil {
+				return 0, err
+			}
+			c += n
+		}
+		if count < 0 || c < count {
+			count = c
+		}
+	}
+	return count, nil
+}
+
+func (g *Generator) uploadImage(ctx context.Context, r io.Reader, ext string) (string, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	objectName, err := randomHex(20)
+	if err != nil {
+		return "", err
+	}
+	objectName += "." + ext
+	w := client.Bucket(g.Bucket).Object(objectName).NewWriter(ctx)
+	w.ACL = []storage.ACLRule{
+		{
+			Entity: storage.AllUsers,
+			Role:   storage.RoleReader,
+		},
+	}
+	w.ContentType = "image/" + ext
+	if _, err := io.Copy(w, r); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		"https://storage.googleapis.com", g.Bucket, objectName,
+	}, "/"), nil
+}
+
+func randomHex(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func generatePNG(state *shogi.State, highlight *shogi.Position, theme string) (io.Reader, error) {
+	style, err := render.Style(theme, highlight)
+	if err != nil {
+		return nil, err
+	}
+	img, err := image.Generate(state, style)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
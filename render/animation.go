@@ -0,0 +1,68 @@
+package render
+
+import (
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"github.com/sugyan/shogi/record"
+	shogiimage "github.com/sugyan/shogi/util/image"
+)
+
+// frame delays of the animation
+const (
+	FrameDelay     = time.Second
+	LastFrameDelay = time.Second * 3
+)
+
+// Frames function returns the images of the initial state and the states after each move,
+// with the destination of the move highlighted
+func Frames(r *record.Record, style *shogiimage.StyleOptions) ([]image.Image, error) {
+	var options shogiimage.StyleOptions
+	if style != nil {
+		options = *style
+	}
+	state := r.State.Clone()
+	frames := make([]image.Image, 0, len(r.Moves)+1)
+	options.HighLight = nil
+	img, err := shogiimage.Generate(state, &options)
+	if err != nil {
+		return nil, err
+	}
+	frames = append(frames, img)
+	for _, move := range r.Moves {
+		state.Apply(move)
+		dst := move.Dst
+		options.HighLight = &dst
+		img, err := shogiimage.Generate(state, &options)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, img)
+	}
+	return frames, nil
+}
+
+// EncodeGIF function writes the frames as an animated GIF
+func EncodeGIF(w io.Writer, frames []image.Image) error {
+	g := &gif.GIF{}
+	for i, frame := range frames {
+		bounds := frame.Bounds()
+		paletted := image.NewPaletted(bounds, palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, bounds, frame, bounds.Min)
+		g.Image = append(g.Image, paletted)
+		g.Delay = append(g.Delay, int(delay(i, len(frames))/(time.Second/100)))
+	}
+	return gif.EncodeAll(w, g)
+}
+
+// delay returns the display duration of i-th frame
+func delay(i, n int) time.Duration {
+	if i == n-1 {
+		return LastFrameDelay
+	}
+	return FrameDelay
+}
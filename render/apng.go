@@ -0,0 +1,165 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"time"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// chunks shared by all frames, which precede the image data
+var pngSharedChunks = []string{"IHDR", "PLTE", "tRNS"}
+
+// EncodeAPNG function writes the frames as an animated PNG.
+// All frames must have the same bounds. Frames with different color models or palettes are encoded as NRGBA.
+func EncodeAPNG(w io.Writer, frames []image.Image) error {
+	if len(frames) == 0 {
+		return errors.New("no frames")
+	}
+	shared, idat, err := encodeAPNGFrames(frames)
+	if err == errAPNGMismatch {
+		converted := make([]image.Image, len(frames))
+		for i, frame := range frames {
+			nrgba := image.NewNRGBA(frame.Bounds())
+			draw.Draw(nrgba, nrgba.Bounds(), frame, frame.Bounds().Min, draw.Src)
+			converted[i] = nrgba
+		}
+		shared, idat, err = encodeAPNGFrames(converted)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+	if err := writePNGChunk(w, "IHDR", shared["IHDR"]); err != nil {
+		return err
+	}
+	// acTL: number of frames, number of plays (0 is infinite)
+	if err := writePNGChunk(w, "acTL", uint32s(uint32(len(frames)), 0)); err != nil {
+		return err
+	}
+	for _, typ := range pngSharedChunks[1:] {
+		if data, ok := shared[typ]; ok {
+			if err := writePNGChunk(w, typ, data); err != nil {
+				return err
+			}
+		}
+	}
+	seq := uint32(0)
+	for i, frame := range frames {
+		bounds := frame.Bounds()
+		// fcTL: sequence, width, height, x offset, y offset
+		fctl := uint32s(seq, uint32(bounds.Dx()), uint32(bounds.Dy()), 0, 0)
+		// delay numerator and denominator (milliseconds), dispose op and blend op
+		fctl = append(fctl, 0, 0, 0x03, 0xe8, 0, 0)
+		binary.BigEndian.PutUint16(fctl[20:], uint16(delay(i, len(frames))/time.Millisecond))
+		if err := writePNGChunk(w, "fcTL", fctl); err != nil {
+			return err
+		}
+		seq++
+		for _, data := range idat[i] {
+			if i == 0 {
+				if err := writePNGChunk(w, "IDAT", data); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := writePNGChunk(w, "fdAT", append(uint32s(seq), data...)); err != nil {
+				return err
+			}
+			seq++
+		}
+	}
+	return writePNGChunk(w, "IEND", nil)
+}
+
+var errAPNGMismatch = errors.New("frames have different headers or palettes")
+
+// encodeAPNGFrames returns the chunks shared by the frames and the image data of each frame
+func encodeAPNGFrames(frames []image.Image) (map[string][]byte, [][][]byte, error) {
+	var (
+		shared map[string][]byte
+		idat   = make([][][]byte, len(frames))
+	)
+	for i, frame := range frames {
+		chunks, err := encodePNGChunks(frame)
+		if err != nil {
+			return nil, nil, err
+		}
+		current := map[string][]byte{}
+		for _, c := range chunks {
+			switch c.typ {
+			case "IDAT":
+				idat[i] = append(idat[i], c.data)
+			default:
+				current[c.typ] = c.data
+			}
+		}
+		if shared == nil {
+			shared = current
+			continue
+		}
+		for _, typ := range pngSharedChunks {
+			if !bytes.Equal(shared[typ], current[typ]) {
+				return nil, nil, errAPNGMismatch
+			}
+		}
+	}
+	return shared, idat, nil
+}
+
+func encodePNGChunks(img image.Image) ([]pngChunk, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()[len(pngSignature):]
+	chunks := []pngChunk{}
+	for len(b) >= 12 {
+		length := binary.BigEndian.Uint32(b[:4])
+		if uint32(len(b)) < 12+length {
+			return nil, errors.New("invalid chunk length")
+		}
+		chunks = append(chunks, pngChunk{
+			typ:  string(b[4:8]),
+			data: b[8 : 8+length],
+		})
+		b = b[12+length:]
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	header := append(uint32s(uint32(len(data))), typ...)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	for _, b := range [][]byte{header, data, uint32s(crc.Sum32())} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uint32s(values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
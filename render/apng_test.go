@@ -0,0 +1,141 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/png"
+	"testing"
+)
+
+// readPNGChunks returns the chunks of the PNG data, checking the signature and the CRCs
+func readPNGChunks(t *testing.T, b []byte) []pngChunk {
+	if !bytes.HasPrefix(b, pngSignature) {
+		t.Fatal("invalid signature")
+	}
+	b = b[len(pngSignature):]
+	chunks := []pngChunk{}
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated chunk: %d bytes", len(b))
+		}
+		length := binary.BigEndian.Uint32(b[:4])
+		typ, data := string(b[4:8]), b[8:8+length]
+		crc := crc32.NewIEEE()
+		crc.Write(b[4 : 8+length])
+		if crc.Sum32() != binary.BigEndian.Uint32(b[8+length:12+length]) {
+			t.Errorf("invalid CRC of %s", typ)
+		}
+		chunks = append(chunks, pngChunk{typ: typ, data: data})
+		b = b[12+length:]
+	}
+	return chunks
+}
+
+func testFrames(n int, paletted bool) []image.Image {
+	frames := make([]image.Image, n)
+	for i := range frames {
+		rect := image.Rect(0, 0, 8, 8)
+		var img interface {
+			image.Image
+			Set(x, y int, c color.Color)
+		}
+		if paletted {
+			img = image.NewPaletted(rect, palette.Plan9)
+		} else {
+			img = image.NewRGBA(rect)
+		}
+		for x := 0; x < 8; x++ {
+			for y := 0; y < 8; y++ {
+				img.Set(x, y, color.RGBA{uint8(x * 32), uint8(y * 32), uint8(i * 64), 0xff})
+			}
+		}
+		frames[i] = img
+	}
+	return frames
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		frames   []image.Image
+		paletted bool
+	}{
+		{"rgba", testFrames(3, false), false},
+		{"paletted", testFrames(3, true), true},
+		{"single", testFrames(1, false), false},
+		{"mixed", append(testFrames(2, true), testFrames(1, false)...), false},
+	} {
+		buf := bytes.NewBuffer(nil)
+		if err := EncodeAPNG(buf, c.frames); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		chunks := readPNGChunks(t, buf.Bytes())
+
+		types := []string{}
+		frames, seq := 0, uint32(0)
+		seenIDAT := false
+		for i, chunk := range chunks {
+			types = append(types, chunk.typ)
+			switch chunk.typ {
+			case "acTL":
+				if n := binary.BigEndian.Uint32(chunk.data); n != uint32(len(c.frames)) {
+					t.Errorf("%s: acTL has %d frames, expected %d", c.name, n, len(c.frames))
+				}
+			case "PLTE":
+				if seenIDAT {
+					t.Errorf("%s: PLTE after IDAT", c.name)
+				}
+			case "fcTL", "fdAT":
+				if s := binary.BigEndian.Uint32(chunk.data); s != seq {
+					t.Errorf("%s: chunk %d (%s) has sequence %d, expected %d", c.name, i, chunk.typ, s, seq)
+				}
+				seq++
+				if chunk.typ == "fcTL" {
+					frames++
+				}
+			case "IDAT":
+				seenIDAT = true
+			}
+		}
+		if frames != len(c.frames) {
+			t.Errorf("%s: %d fcTL chunks, expected %d", c.name, frames, len(c.frames))
+		}
+		if types[0] != "IHDR" || types[len(types)-1] != "IEND" {
+			t.Errorf("%s: invalid chunk order %v", c.name, types)
+		}
+		hasPLTE := false
+		for _, typ := range types {
+			hasPLTE = hasPLTE || typ == "PLTE"
+		}
+		if hasPLTE != c.paletted {
+			t.Errorf("%s: PLTE present %v, expected %v", c.name, hasPLTE, c.paletted)
+		}
+
+		// decoders without APNG support show the first frame
+		img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for _, p := range []image.Point{{0, 0}, {3, 5}, {7, 7}} {
+			r0, g0, b0, _ := c.frames[0].At(p.X, p.Y).RGBA()
+			r1, g1, b1, _ := img.At(p.X, p.Y).RGBA()
+			if r0 != r1 || g0 != g1 || b0 != b1 {
+				t.Errorf("%s: pixel at %v differs from the first frame", c.name, p)
+			}
+		}
+	}
+}
+
+func TestEncodeAPNGErrors(t *testing.T) {
+	if err := EncodeAPNG(bytes.NewBuffer(nil), nil); err == nil {
+		t.Error("expected error for no frames")
+	}
+	frames := []image.Image{image.NewRGBA(image.Rect(0, 0, 8, 8)), image.NewRGBA(image.Rect(0, 0, 4, 4))}
+	if err := EncodeAPNG(bytes.NewBuffer(nil), frames); err == nil {
+		t.Error("expected error for different bounds")
+	}
+}
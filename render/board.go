@@ -0,0 +1,147 @@
+package render
+
+import "github.com/sugyan/shogi"
+
+// pieceChars are the single characters of pieces on the board
+var pieceChars = map[shogi.Piece]string{
+	shogi.FU: "歩",
+	shogi.KY: "香",
+	shogi.KE: "桂",
+	shogi.GI: "銀",
+	shogi.KI: "金",
+	shogi.KA: "角",
+	shogi.HI: "飛",
+	shogi.OU: "玉",
+	shogi.TO: "と",
+	shogi.NY: "杏",
+	shogi.NK: "圭",
+	shogi.NG: "全",
+	shogi.UM: "馬",
+	shogi.RY: "龍",
+}
+
+// pieceNames are the names of pieces used in the descriptions of moves
+var pieceNames = map[shogi.Piece]string{
+	shogi.FU: "歩",
+	shogi.KY: "香",
+	shogi.KE: "桂",
+	shogi.GI: "銀",
+	shogi.KI: "金",
+	shogi.KA: "角",
+	shogi.HI: "飛",
+	shogi.OU: "玉",
+	shogi.TO: "と",
+	shogi.NY: "成香",
+	shogi.NK: "成桂",
+	shogi.NG: "成銀",
+	shogi.UM: "馬",
+	shogi.RY: "龍",
+}
+
+// pieceNamesEnglish are the English names of pieces
+var pieceNamesEnglish = map[shogi.Piece]string{
+	shogi.FU: "pawn",
+	shogi.KY: "lance",
+	shogi.KE: "knight",
+	shogi.GI: "silver",
+	shogi.KI: "gold",
+	shogi.KA: "bishop",
+	shogi.HI: "rook",
+	shogi.OU: "king",
+	shogi.TO: "promoted pawn",
+	shogi.NY: "promoted lance",
+	shogi.NK: "promoted knight",
+	shogi.NG: "promoted silver",
+	shogi.UM: "horse",
+	shogi.RY: "dragon",
+}
+
+// pieceCodes are the piece names in CSA format
+var pieceCodes = map[shogi.Piece]string{
+	shogi.FU: "FU",
+	shogi.KY: "KY",
+	shogi.KE: "KE",
+	shogi.GI: "GI",
+	shogi.KI: "KI",
+	shogi.KA: "KA",
+	shogi.HI: "HI",
+	shogi.OU: "OU",
+	shogi.TO: "TO",
+	shogi.NY: "NY",
+	shogi.NK: "NK",
+	shogi.NG: "NG",
+	shogi.UM: "UM",
+	shogi.RY: "RY",
+}
+
+// handPieces are the kinds of captured pieces in the conventional order
+var handPieces = []shogi.Piece{
+	shogi.HI, shogi.KA, shogi.KI, shogi.GI, shogi.KE, shogi.KY, shogi.FU,
+}
+
+var (
+	fileChars = []string{"", "１", "２", "３", "４", "５", "６", "７", "８", "９"}
+	rankChars = []string{"", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+)
+
+// handCount returns the number of the captured piece
+func handCount(c *shogi.CapturedPieces, p shogi.Piece) int {
+	if c == nil {
+		return 0
+	}
+	switch p {
+	case shogi.FU:
+		return c.FU
+	case shogi.KY:
+		return c.KY
+	case shogi.KE:
+		return c.KE
+	case shogi.GI:
+		return c.GI
+	case shogi.KI:
+		return c.KI
+	case shogi.KA:
+		return c.KA
+	case shogi.HI:
+		return c.HI
+	}
+	return 0
+}
+
+// kanjiNumber returns the number in kanji (up to 18, the maximum of captured pieces)
+func kanjiNumber(n int) string {
+	if n < 10 {
+		return rankChars[n]
+	}
+	return "十" + rankChars[n-10]
+}
+
+// PieceName function returns the Japanese name of the piece such as "成銀"
+func PieceName(p shogi.Piece) string {
+	return pieceNames[p]
+}
+
+// PositionName function returns the Japanese notation of the square such as "２三"
+func PositionName(pos shogi.Position) string {
+	return fileChars[pos.File] + rankChars[pos.Rank]
+}
+
+// IsDrop function returns true if the move drops a captured piece
+func IsDrop(move *shogi.Move) bool {
+	return move.Src.File == 0 && move.Src.Rank == 0
+}
+
+// PieceCode function returns the piece name in CSA format such as "FU"
+func PieceCode(p shogi.Piece) string {
+	return pieceCodes[p]
+}
+
+// ParsePieceCode function returns the piece of the name in CSA format
+func ParsePieceCode(code string) (shogi.Piece, bool) {
+	for p, c := range pieceCodes {
+		if c == code {
+			return p, true
+		}
+	}
+	return 0, false
+}
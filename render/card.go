@@ -0,0 +1,71 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// size of the card image for OGP
+const (
+	CardWidth      = 1200
+	CardHeight     = 630
+	cardMargin     = 30
+	cardLineHeight = 64
+)
+
+var cardBackground = color.RGBA{0xf8, 0xf4, 0xe8, 0xff}
+
+// Card function returns the image of the board with the lines of text on the right side.
+// basicfont is used if face is nil, so the text should be ASCII in that case.
+func Card(board image.Image, lines []string, face font.Face) image.Image {
+	if face == nil {
+		face = basicfont.Face7x13
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, CardWidth, CardHeight))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(cardBackground), image.ZP, draw.Src)
+
+	// board on the left side, scaled to fit the height
+	size := board.Bounds().Size()
+	height := CardHeight - cardMargin*2
+	width := size.X * height / size.Y
+	boardRect := image.Rect(cardMargin, cardMargin, cardMargin+width, cardMargin+height)
+	xdraw.CatmullRom.Scale(dst, boardRect, board, board.Bounds(), draw.Over, nil)
+
+	// text on the right side, scaled to the line height
+	left := boardRect.Max.X + cardMargin
+	for i, line := range lines {
+		text := textImage(line, face)
+		scale := float64(cardLineHeight) / float64(text.Bounds().Dy())
+		w := int(float64(text.Bounds().Dx()) * scale)
+		if max := CardWidth - cardMargin - left; w > max {
+			w, scale = max, float64(max)/float64(text.Bounds().Dx())
+		}
+		top := cardMargin*2 + i*(cardLineHeight+cardMargin)
+		rect := image.Rect(left, top, left+w, top+int(float64(text.Bounds().Dy())*scale))
+		xdraw.NearestNeighbor.Scale(dst, rect, text, text.Bounds(), draw.Over, nil)
+	}
+	return dst
+}
+
+func textImage(text string, face font.Face) image.Image {
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text).Ceil()
+	if width == 0 {
+		width = 1
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, metrics.Height.Ceil()))
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+	d.DrawString(text)
+	return img
+}
@@ -0,0 +1,87 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sugyan/shogi"
+)
+
+// Description type represents the position in text for screen readers
+type Description struct {
+	Japanese string
+	English  string
+}
+
+// Describe function returns the description of the position of the problem.
+// The first player is the attacker, and the second player is the defender.
+func Describe(state *shogi.State) *Description {
+	var (
+		attackerJa, defenderJa []string
+		attackerEn, defenderEn []string
+		kingJa, kingEn         = "なし", "none"
+	)
+	for rank := 1; rank <= 9; rank++ {
+		for file := 9; file >= 1; file-- {
+			bp := state.GetBoardPiece(file, rank)
+			if bp == nil {
+				continue
+			}
+			ja := PositionName(shogi.Position{File: file, Rank: rank}) + pieceNames[bp.Piece]
+			en := fmt.Sprintf("%s at %d-%d", pieceNamesEnglish[bp.Piece], file, rank)
+			if bp.Turn == shogi.TurnFirst {
+				attackerJa, attackerEn = append(attackerJa, ja), append(attackerEn, en)
+				continue
+			}
+			defenderJa, defenderEn = append(defenderJa, ja), append(defenderEn, en)
+			if bp.Piece == shogi.OU {
+				kingJa, kingEn = PositionName(shogi.Position{File: file, Rank: rank}), fmt.Sprintf("%d-%d", file, rank)
+			}
+		}
+	}
+	handJa, handEn := describeHand(state.Captured[0])
+	return &Description{
+		Japanese: fmt.Sprintf(
+			"攻め方の持駒: %s。玉方の玉: %s。攻め方の駒: %s。玉方の駒: %s。",
+			handJa, kingJa, joinOr(attackerJa, "、", "なし"), joinOr(defenderJa, "、", "なし"),
+		),
+		English: fmt.Sprintf(
+			"Attacker holds: %s. Defender king on %s. Attacker pieces: %s. Defender pieces: %s.",
+			handEn, kingEn, joinOr(attackerEn, ", ", "none"), joinOr(defenderEn, ", ", "none"),
+		),
+	}
+}
+
+func describeHand(captured *shogi.CapturedPieces) (string, string) {
+	ja, en := []string{}, []string{}
+	for _, p := range handPieces {
+		n := handCount(captured, p)
+		if n == 0 {
+			continue
+		}
+		if n > 1 {
+			ja = append(ja, pieceNames[p]+kanjiNumber(n))
+			en = append(en, fmt.Sprintf("%d %ss", n, pieceNamesEnglish[p]))
+		} else {
+			ja = append(ja, pieceNames[p])
+			en = append(en, pieceNamesEnglish[p])
+		}
+	}
+	return joinOr(ja, "、", "なし"), joinOr(en, ", ", "nothing")
+}
+
+func joinOr(s []string, sep, empty string) string {
+	if len(s) == 0 {
+		return empty
+	}
+	return strings.Join(s, sep)
+}
+
+// Truncate function shortens the text to the maximum number of characters
+func Truncate(text string, max int) string {
+	r := []rune(text)
+	if len(r) <= max {
+		return text
+	}
+	return string(r[:max-1]) + "…"
+}
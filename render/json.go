@@ -0,0 +1,43 @@
+package render
+
+import "github.com/sugyan/shogi"
+
+// StateJSON type is the JSON representation of the state for web clients
+type StateJSON struct {
+	// Board is indexed by [rank-1][9-file], nil for empty squares
+	Board [9][9]*PieceJSON `json:"board"`
+	// Hands are the numbers of captured pieces of the first and the second player
+	Hands [2]map[string]int `json:"hands"`
+}
+
+// PieceJSON type
+type PieceJSON struct {
+	Piece string `json:"piece"`
+	First bool   `json:"first"`
+}
+
+// NewStateJSON function returns the JSON representation of the state
+func NewStateJSON(state *shogi.State) *StateJSON {
+	s := &StateJSON{}
+	for file := 1; file <= 9; file++ {
+		for rank := 1; rank <= 9; rank++ {
+			bp := state.GetBoardPiece(file, rank)
+			if bp == nil {
+				continue
+			}
+			s.Board[rank-1][9-file] = &PieceJSON{
+				Piece: pieceCodes[bp.Piece],
+				First: bp.Turn == shogi.TurnFirst,
+			}
+		}
+	}
+	for i, captured := range state.Captured {
+		s.Hands[i] = map[string]int{}
+		for _, p := range handPieces {
+			if n := handCount(captured, p); n > 0 {
+				s.Hands[i][pieceCodes[p]] = n
+			}
+		}
+	}
+	return s
+}
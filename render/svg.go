@@ -0,0 +1,131 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sugyan/shogi"
+)
+
+// SVG layout
+const (
+	svgCellSize   = 40
+	svgHandWidth  = 40
+	svgLabelSize  = 20
+	svgBoardLeft  = svgHandWidth + 10
+	svgBoardTop   = svgLabelSize
+	svgBoardSize  = svgCellSize * 9
+	svgRightHand  = svgBoardLeft + svgBoardSize + svgLabelSize + 10
+	svgWidth      = svgRightHand + svgHandWidth
+	svgHeight     = svgBoardTop + svgBoardSize + 10
+	svgFontSize   = 28
+	svgLabelFont  = 14
+	svgDefaultCSS = `
+.tsume-shogi .tsume-board { fill: #f0d9a0; stroke: #333; stroke-width: 2; }
+.tsume-shogi .tsume-grid { stroke: #333; stroke-width: 1; }
+.tsume-shogi .tsume-highlight { fill: #f8a060; }
+.tsume-shogi .tsume-piece, .tsume-shogi .tsume-hand { font-family: serif; fill: #000; }
+.tsume-shogi .tsume-label { font-family: sans-serif; fill: #333; }
+`
+)
+
+// SVGOptions type
+type SVGOptions struct {
+	// CSS overrides the default style if not empty
+	CSS string
+	// HighLights are the squares to be highlighted
+	HighLights []shogi.Position
+}
+
+// SVG function writes the state as an SVG image.
+// The root has class "tsume-shogi", and the elements have classes "tsume-board", "tsume-grid", "tsume-highlight",
+// "tsume-piece", "tsume-first", "tsume-second", "tsume-hand" and "tsume-label" to be styled with CSS.
+// The classes are prefixed not to style the page the image is inlined into.
+func SVG(w io.Writer, state *shogi.State, options *SVGOptions) error {
+	if options == nil {
+		options = &SVGOptions{}
+	}
+	css := options.CSS
+	if css == "" {
+		css = svgDefaultCSS
+	}
+	b := bytes.NewBuffer(nil)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" class="tsume-shogi" viewBox="0 0 %d %d">`, svgWidth, svgHeight)
+	fmt.Fprintf(b, `<style><![CDATA[%s]]></style>`, css)
+	// pattern of the "stripe" board
+	b.WriteString(`<defs><pattern id="tsume-stripe" width="8" height="8" patternUnits="userSpaceOnUse">` +
+		`<rect width="8" height="8" fill="#f0d9a0"/><rect width="8" height="3" fill="#e6c98a"/></pattern></defs>`)
+
+	// board and highlighted squares
+	fmt.Fprintf(b, `<rect class="tsume-board" x="%d" y="%d" width="%d" height="%d"/>`, svgBoardLeft, svgBoardTop, svgBoardSize, svgBoardSize)
+	for _, pos := range options.HighLights {
+		x, y := svgCell(pos.File, pos.Rank)
+		fmt.Fprintf(b, `<rect class="tsume-highlight" x="%d" y="%d" width="%d" height="%d"/>`, x, y, svgCellSize, svgCellSize)
+	}
+	for i := 1; i < 9; i++ {
+		fmt.Fprintf(b, `<line class="tsume-grid" x1="%d" y1="%d" x2="%d" y2="%d"/>`,
+			svgBoardLeft+i*svgCellSize, svgBoardTop, svgBoardLeft+i*svgCellSize, svgBoardTop+svgBoardSize)
+		fmt.Fprintf(b, `<line class="tsume-grid" x1="%d" y1="%d" x2="%d" y2="%d"/>`,
+			svgBoardLeft, svgBoardTop+i*svgCellSize, svgBoardLeft+svgBoardSize, svgBoardTop+i*svgCellSize)
+	}
+	// coordinates
+	for i := 1; i <= 9; i++ {
+		x, y := svgCell(i, i)
+		fmt.Fprintf(b, `<text class="tsume-label" x="%d" y="%d" font-size="%d" text-anchor="middle">%s</text>`,
+			x+svgCellSize/2, svgLabelSize-4, svgLabelFont, fileChars[i])
+		fmt.Fprintf(b, `<text class="tsume-label" x="%d" y="%d" font-size="%d" text-anchor="middle">%s</text>`,
+			svgBoardLeft+svgBoardSize+svgLabelSize/2, y+svgCellSize/2+svgLabelFont/2, svgLabelFont, rankChars[i])
+	}
+	// pieces
+	for file := 1; file <= 9; file++ {
+		for rank := 1; rank <= 9; rank++ {
+			bp := state.GetBoardPiece(file, rank)
+			if bp == nil {
+				continue
+			}
+			x, y := svgCell(file, rank)
+			cx, cy := x+svgCellSize/2, y+svgCellSize/2
+			class, transform := "tsume-piece tsume-first", ""
+			if bp.Turn == shogi.TurnSecond {
+				class, transform = "tsume-piece tsume-second", fmt.Sprintf(` transform="rotate(180 %d %d)"`, cx, cy)
+			}
+			fmt.Fprintf(b, `<text class="%s" x="%d" y="%d" font-size="%d" text-anchor="middle" dominant-baseline="central"%s>%s</text>`,
+				class, cx, cy, svgFontSize, transform, pieceChars[bp.Piece])
+		}
+	}
+	// captured pieces: first player on the right, second player on the left
+	svgHand(b, "☗", state.Captured[0], svgRightHand, "tsume-hand tsume-first")
+	svgHand(b, "☖", state.Captured[1], 0, "tsume-hand tsume-second")
+
+	b.WriteString(`</svg>`)
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// svgCell returns the top-left coordinates of the square
+func svgCell(file, rank int) (int, int) {
+	return svgBoardLeft + (9-file)*svgCellSize, svgBoardTop + (rank-1)*svgCellSize
+}
+
+func svgHand(b *bytes.Buffer, mark string, captured *shogi.CapturedPieces, left int, class string) {
+	chars := []string{mark}
+	for _, p := range handPieces {
+		n := handCount(captured, p)
+		if n == 0 {
+			continue
+		}
+		chars = append(chars, pieceChars[p])
+		if n > 1 {
+			chars = append(chars, strings.Split(kanjiNumber(n), "")...)
+		}
+	}
+	if len(chars) == 1 {
+		chars = append(chars, "な", "し")
+	}
+	for i, c := range chars {
+		fmt.Fprintf(b, `<text class="%s" x="%d" y="%d" font-size="%d" text-anchor="middle">%s</text>`,
+			class, left+svgHandWidth/2, svgBoardTop+(i+1)*svgLabelSize+4, svgLabelSize, c)
+	}
+}
@@ -0,0 +1,51 @@
+package render
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/sugyan/shogi"
+)
+
+// Text function writes the state as a Unicode board diagram with captured pieces
+func Text(w io.Writer, state *shogi.State) error {
+	b := bytes.NewBufferString("後手の持駒：" + textHand(state.Captured[1]) + "\n")
+	b.WriteString("  ９ ８ ７ ６ ５ ４ ３ ２ １\n")
+	b.WriteString("┌" + strings.Repeat("─", 27) + "┐\n")
+	for rank := 1; rank <= 9; rank++ {
+		b.WriteString("│")
+		for file := 9; file >= 1; file-- {
+			bp := state.GetBoardPiece(file, rank)
+			switch {
+			case bp == nil:
+				b.WriteString(" ・")
+			case bp.Turn == shogi.TurnFirst:
+				b.WriteString(" " + pieceChars[bp.Piece])
+			default:
+				b.WriteString("v" + pieceChars[bp.Piece])
+			}
+		}
+		b.WriteString("│" + rankChars[rank] + "\n")
+	}
+	b.WriteString("└" + strings.Repeat("─", 27) + "┘\n")
+	b.WriteString("先手の持駒：" + textHand(state.Captured[0]) + "\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+func textHand(captured *shogi.CapturedPieces) string {
+	pieces := []string{}
+	for _, p := range handPieces {
+		n := handCount(captured, p)
+		if n == 0 {
+			continue
+		}
+		if n > 1 {
+			pieces = append(pieces, pieceChars[p]+kanjiNumber(n))
+		} else {
+			pieces = append(pieces, pieceChars[p])
+		}
+	}
+	return joinOr(pieces, "　", "なし")
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sugyan/shogi"
+	"github.com/sugyan/shogi/util/image"
+)
+
+// DefaultTheme is used if no theme is specified
+const DefaultTheme = "stripe_dirty"
+
+var themes = map[string]image.StyleOptions{
+	"plain":        {},
+	"stripe":       {Board: image.BoardStripe},
+	"dirty":        {Piece: image.PieceDirty},
+	"stripe_dirty": {Board: image.BoardStripe, Piece: image.PieceDirty},
+}
+
+// Themes function returns the names of all themes
+func Themes() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Style function returns the style options of the theme with the highlighted square.
+// DefaultTheme is used if the theme is empty.
+func Style(theme string, highlight *shogi.Position) (*image.StyleOptions, error) {
+	if theme == "" {
+		theme = DefaultTheme
+	}
+	style, ok := themes[theme]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme: %s", theme)
+	}
+	style.HighLight = highlight
+	return &style, nil
+}
+
+// CSS of the SVG images for each theme, appended to the default style
+var svgThemes = map[string]string{
+	"plain":        "",
+	"stripe":       svgStripeCSS,
+	"dirty":        svgDirtyCSS,
+	"stripe_dirty": svgStripeCSS + svgDirtyCSS,
+}
+
+const (
+	svgStripeCSS = `
+.tsume-shogi .tsume-board { fill: url(#tsume-stripe); }
+`
+	svgDirtyCSS = `
+.tsume-shogi .tsume-piece { fill: #3a2a1a; font-weight: bold; }
+`
+)
+
+// SVGCSS function returns the CSS of the SVG image of the theme.
+// DefaultTheme is used if the theme is empty.
+func SVGCSS(theme string) (string, error) {
+	if theme == "" {
+		theme = DefaultTheme
+	}
+	css, ok := svgThemes[theme]
+	if !ok {
+		return "", fmt.Errorf("unknown theme: %s", theme)
+	}
+	return svgDefaultCSS + css, nil
+}
@@ -0,0 +1,401 @@
+package rules
+
+import (
+	"errors"
+
+	"github.com/sugyan/shogi"
+)
+
+// ErrLimit is returned if a search expands more positions than its limit
+var ErrLimit = errors.New("rules: search limit exceeded")
+
+// Move type is a move on the Board. Src is zero for dropping a captured piece, and Piece is the piece after the move.
+type Move struct {
+	Src   shogi.Position
+	Dst   shogi.Position
+	Piece shogi.Piece
+}
+
+// IsDrop method returns true if the move drops a captured piece
+func (m *Move) IsDrop() bool {
+	return m.Src.File == 0 && m.Src.Rank == 0
+}
+
+// Equal method returns true if the moves are the same
+func (m *Move) Equal(o *Move) bool {
+	return m.Src == o.Src && m.Dst == o.Dst && m.Piece == o.Piece
+}
+
+// Board type is a position to validate moves, which depends on the rules of shogi only.
+// It is a value without references to be copied cheaply.
+type Board struct {
+	// squares are indexed by [file][rank]
+	squares [10][10]square
+	// hands are indexed by [player][index in handPieces]
+	hands [2][7]int
+}
+
+type square struct {
+	occupied bool
+	turn     shogi.Turn
+	piece    shogi.Piece
+}
+
+var handPieces = [7]shogi.Piece{
+	shogi.FU, shogi.KY, shogi.KE, shogi.GI, shogi.KI, shogi.KA, shogi.HI,
+}
+
+// handSlot returns the index of the piece in handPieces, or -1 if it is not held in hand
+func handSlot(p shogi.Piece) int {
+	for i, h := range handPieces {
+		if h == p {
+			return i
+		}
+	}
+	return -1
+}
+
+var promoted = map[shogi.Piece]shogi.Piece{
+	shogi.FU: shogi.TO,
+	shogi.KY: shogi.NY,
+	shogi.KE: shogi.NK,
+	shogi.GI: shogi.NG,
+	shogi.KA: shogi.UM,
+	shogi.HI: shogi.RY,
+}
+
+var unpromoted = map[shogi.Piece]shogi.Piece{
+	shogi.TO: shogi.FU,
+	shogi.NY: shogi.KY,
+	shogi.NK: shogi.KE,
+	shogi.NG: shogi.GI,
+	shogi.UM: shogi.KA,
+	shogi.RY: shogi.HI,
+}
+
+type direction struct {
+	file, rank int
+}
+
+var (
+	goldSteps = []direction{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {0, 1}}
+	kingSteps = []direction{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+	diagonals = []direction{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}}
+	straights = []direction{{0, -1}, {-1, 0}, {1, 0}, {0, 1}}
+)
+
+// steps and slides of the pieces of the first player. The rank decreases forward.
+var (
+	pieceSteps = map[shogi.Piece][]direction{
+		shogi.FU: {{0, -1}},
+		shogi.KE: {{-1, -2}, {1, -2}},
+		shogi.GI: {{-1, -1}, {0, -1}, {1, -1}, {-1, 1}, {1, 1}},
+		shogi.KI: goldSteps,
+		shogi.TO: goldSteps,
+		shogi.NY: goldSteps,
+		shogi.NK: goldSteps,
+		shogi.NG: goldSteps,
+		shogi.OU: kingSteps,
+		shogi.UM: straights,
+		shogi.RY: diagonals,
+	}
+	pieceSlides = map[shogi.Piece][]direction{
+		shogi.KY: {{0, -1}},
+		shogi.KA: diagonals,
+		shogi.HI: straights,
+		shogi.UM: diagonals,
+		shogi.RY: straights,
+	}
+)
+
+// NewBoard function returns the board of the state
+func NewBoard(state *shogi.State) *Board {
+	b := &Board{}
+	for file := 1; file <= 9; file++ {
+		for rank := 1; rank <= 9; rank++ {
+			if bp := state.GetBoardPiece(file, rank); bp != nil {
+				b.squares[file][rank] = square{occupied: true, turn: bp.Turn, piece: bp.Piece}
+			}
+		}
+	}
+	for i, captured := range state.Captured {
+		if captured == nil {
+			continue
+		}
+		b.hands[i] = [7]int{captured.FU, captured.KY, captured.KE, captured.GI, captured.KI, captured.KA, captured.HI}
+	}
+	return b
+}
+
+// Clone method returns the copy of the board
+func (b *Board) Clone() *Board {
+	c := *b
+	return &c
+}
+
+// Apply method applies the move of the player without validation
+func (b *Board) Apply(turn shogi.Turn, m *Move) {
+	hand := &b.hands[handIndex(turn)]
+	if captured := b.squares[m.Dst.File][m.Dst.Rank]; captured.occupied {
+		p := captured.piece
+		if u, ok := unpromoted[p]; ok {
+			p = u
+		}
+		if i := handSlot(p); i >= 0 {
+			hand[i]++
+		}
+	}
+	if m.IsDrop() {
+		hand[handSlot(m.Piece)]--
+	} else {
+		b.squares[m.Src.File][m.Src.Rank] = square{}
+	}
+	b.squares[m.Dst.File][m.Dst.Rank] = square{occupied: true, turn: turn, piece: m.Piece}
+}
+
+// IsLegal method returns true if the move is one of the legal moves of the player
+func (b *Board) IsLegal(turn shogi.Turn, m *Move) bool {
+	for _, legal := range b.LegalMoves(turn) {
+		if legal.Equal(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// LegalMoves method returns all legal moves of the player in a fixed order
+func (b *Board) LegalMoves(turn shogi.Turn) []*Move {
+	moves := []*Move{}
+	for _, m := range b.pseudoMoves(turn) {
+		c := *b
+		c.Apply(turn, m)
+		if c.InCheck(turn) {
+			continue
+		}
+		// dropping a pawn to mate is prohibited
+		if m.IsDrop() && m.Piece == shogi.FU && c.IsMate(opponent(turn)) {
+			continue
+		}
+		moves = append(moves, m)
+	}
+	return moves
+}
+
+// InCheck method returns true if the king of the player is attacked. It is false if the player has no king.
+func (b *Board) InCheck(turn shogi.Turn) bool {
+	for file := 1; file <= 9; file++ {
+		for rank := 1; rank <= 9; rank++ {
+			sq := b.squares[file][rank]
+			if sq.occupied && sq.turn == turn && sq.piece == shogi.OU {
+				return b.attacked(opponent(turn), file, rank)
+			}
+		}
+	}
+	return false
+}
+
+// IsMate method returns true if the player is checked and has no legal moves
+func (b *Board) IsMate(turn shogi.Turn) bool {
+	return b.InCheck(turn) && len(b.LegalMoves(turn)) == 0
+}
+
+// Search type searches mates by checking continuously, expanding at most Limit positions if positive,
+// so that the work is bounded whatever positions are given
+type Search struct {
+	Limit    int
+	expanded int
+}
+
+// CanMate method returns true if the first player, to move, can mate within n moves by checking continuously
+// whatever the second player replies
+func (s *Search) CanMate(b *Board, n int) (bool, error) {
+	if n <= 0 {
+		return false, nil
+	}
+	moves, err := s.expand(b, shogi.TurnFirst)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range moves {
+		c := *b
+		c.Apply(shogi.TurnFirst, m)
+		if !c.InCheck(shogi.TurnSecond) {
+			continue
+		}
+		ok, err := s.MateForced(&c, n-1)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MateForced method returns true if the first player can mate within n more moves whatever the second player,
+// who is checked and to move, replies. It is true if the second player is already mated.
+func (s *Search) MateForced(b *Board, n int) (bool, error) {
+	replies, err := s.expand(b, shogi.TurnSecond)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range replies {
+		c := *b
+		c.Apply(shogi.TurnSecond, r)
+		ok, err := s.CanMate(&c, n)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// expand returns the legal moves of the position, counting it against the limit
+func (s *Search) expand(b *Board, turn shogi.Turn) ([]*Move, error) {
+	s.expanded++
+	if s.Limit > 0 && s.expanded > s.Limit {
+		return nil, ErrLimit
+	}
+	return b.LegalMoves(turn), nil
+}
+
+// pseudoMoves returns the moves of the player without considering checks
+func (b *Board) pseudoMoves(turn shogi.Turn) []*Move {
+	moves := []*Move{}
+	for file := 1; file <= 9; file++ {
+		for rank := 1; rank <= 9; rank++ {
+			sq := b.squares[file][rank]
+			if !sq.occupied || sq.turn != turn {
+				continue
+			}
+			src := shogi.Position{File: file, Rank: rank}
+			for _, dst := range b.destinations(turn, sq.piece, file, rank) {
+				if p, ok := promoted[sq.piece]; ok && (inZone(turn, rank) || inZone(turn, dst.Rank)) {
+					moves = append(moves, &Move{Src: src, Dst: dst, Piece: p})
+				}
+				if canStay(turn, sq.piece, dst.Rank) {
+					moves = append(moves, &Move{Src: src, Dst: dst, Piece: sq.piece})
+				}
+			}
+		}
+	}
+	hand := b.hands[handIndex(turn)]
+	for i, p := range handPieces {
+		if hand[i] == 0 {
+			continue
+		}
+		for file := 1; file <= 9; file++ {
+			if p == shogi.FU && b.hasPawn(turn, file) {
+				continue
+			}
+			for rank := 1; rank <= 9; rank++ {
+				if b.squares[file][rank].occupied || !canStay(turn, p, rank) {
+					continue
+				}
+				moves = append(moves, &Move{Dst: shogi.Position{File: file, Rank: rank}, Piece: p})
+			}
+		}
+	}
+	return moves
+}
+
+// destinations returns the squares where the piece can move to
+func (b *Board) destinations(turn shogi.Turn, piece shogi.Piece, file, rank int) []shogi.Position {
+	sign := 1
+	if turn == shogi.TurnSecond {
+		sign = -1
+	}
+	dsts := []shogi.Position{}
+	for _, d := range pieceSteps[piece] {
+		f, r := file+d.file*sign, rank+d.rank*sign
+		if onBoard(f, r) && !b.ownedBy(turn, f, r) {
+			dsts = append(dsts, shogi.Position{File: f, Rank: r})
+		}
+	}
+	for _, d := range pieceSlides[piece] {
+		for f, r := file+d.file*sign, rank+d.rank*sign; onBoard(f, r); f, r = f+d.file*sign, r+d.rank*sign {
+			if b.ownedBy(turn, f, r) {
+				break
+			}
+			dsts = append(dsts, shogi.Position{File: f, Rank: r})
+			if b.squares[f][r].occupied {
+				break
+			}
+		}
+	}
+	return dsts
+}
+
+// attacked returns true if any piece of the player can move to the square
+func (b *Board) attacked(turn shogi.Turn, file, rank int) bool {
+	for f := 1; f <= 9; f++ {
+		for r := 1; r <= 9; r++ {
+			sq := b.squares[f][r]
+			if !sq.occupied || sq.turn != turn {
+				continue
+			}
+			for _, dst := range b.destinations(turn, sq.piece, f, r) {
+				if dst.File == file && dst.Rank == rank {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (b *Board) ownedBy(turn shogi.Turn, file, rank int) bool {
+	sq := b.squares[file][rank]
+	return sq.occupied && sq.turn == turn
+}
+
+func (b *Board) hasPawn(turn shogi.Turn, file int) bool {
+	for rank := 1; rank <= 9; rank++ {
+		sq := b.squares[file][rank]
+		if sq.occupied && sq.turn == turn && sq.piece == shogi.FU {
+			return true
+		}
+	}
+	return false
+}
+
+func onBoard(file, rank int) bool {
+	return file >= 1 && file <= 9 && rank >= 1 && rank <= 9
+}
+
+// inZone returns true if the rank is in the promotion zone of the player
+func inZone(turn shogi.Turn, rank int) bool {
+	if turn == shogi.TurnSecond {
+		return rank >= 7
+	}
+	return rank <= 3
+}
+
+// canStay returns false if the piece has no moves on the rank, such as a pawn on the last rank
+func canStay(turn shogi.Turn, piece shogi.Piece, rank int) bool {
+	if turn == shogi.TurnSecond {
+		rank = 10 - rank
+	}
+	switch piece {
+	case shogi.FU, shogi.KY:
+		return rank > 1
+	case shogi.KE:
+		return rank > 2
+	}
+	return true
+}
+
+func handIndex(turn shogi.Turn) int {
+	if turn == shogi.TurnSecond {
+		return 1
+	}
+	return 0
+}
+
+func opponent(turn shogi.Turn) shogi.Turn {
+	if turn == shogi.TurnSecond {
+		return shogi.TurnFirst
+	}
+	return shogi.TurnSecond
+}
@@ -0,0 +1,199 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/sugyan/shogi"
+)
+
+type placed struct {
+	file, rank int
+	turn       shogi.Turn
+	piece      shogi.Piece
+}
+
+// testBoard returns the board with the pieces and the pieces in the hand of the first player
+func testBoard(pieces []placed, hand ...shogi.Piece) *Board {
+	b := &Board{}
+	for _, p := range pieces {
+		b.squares[p.file][p.rank] = square{occupied: true, turn: p.turn, piece: p.piece}
+	}
+	for _, p := range hand {
+		b.hands[0][handSlot(p)]++
+	}
+	return b
+}
+
+func drop(file, rank int, piece shogi.Piece) *Move {
+	return &Move{Dst: shogi.Position{File: file, Rank: rank}, Piece: piece}
+}
+
+func move(srcFile, srcRank, dstFile, dstRank int, piece shogi.Piece) *Move {
+	return &Move{
+		Src:   shogi.Position{File: srcFile, Rank: srcRank},
+		Dst:   shogi.Position{File: dstFile, Rank: dstRank},
+		Piece: piece,
+	}
+}
+
+const (
+	first  = shogi.TurnFirst
+	second = shogi.TurnSecond
+)
+
+// the king of the second player in the corner, whose escapes are blocked by its own knight and lance
+var cornerPieces = []placed{
+	{1, 1, second, shogi.OU},
+	{2, 1, second, shogi.KE},
+	{2, 2, second, shogi.KY},
+	{1, 3, first, shogi.KI},
+	{5, 9, first, shogi.OU},
+}
+
+func TestIsLegal(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		board  *Board
+		turn   shogi.Turn
+		move   *Move
+		expect bool
+	}{
+		// 二歩
+		{"nifu", testBoard([]placed{{5, 7, first, shogi.FU}}, shogi.FU), first, drop(5, 5, shogi.FU), false},
+		{"pawn drop on another file", testBoard([]placed{{5, 7, first, shogi.FU}}, shogi.FU), first, drop(4, 5, shogi.FU), true},
+		{"nifu ignores promoted pawns", testBoard([]placed{{5, 3, first, shogi.TO}}, shogi.FU), first, drop(5, 5, shogi.FU), true},
+		{"nifu ignores the pawns of the opponent", testBoard([]placed{{5, 3, second, shogi.FU}}, shogi.FU), first, drop(5, 5, shogi.FU), true},
+		// 打ち歩詰め
+		{"uchifuzume", testBoard(cornerPieces, shogi.FU), first, drop(1, 2, shogi.FU), false},
+		{"pawn drop check with an escape", testBoard([]placed{cornerPieces[0], cornerPieces[2], cornerPieces[3], cornerPieces[4]}, shogi.FU), first, drop(1, 2, shogi.FU), true},
+		{"pawn push mate", testBoard(append([]placed{{1, 3, first, shogi.FU}, {1, 4, first, shogi.KY}}, cornerPieces[:3]...)), first, move(1, 3, 1, 2, shogi.FU), true},
+		// forced promotion
+		{"pawn to the last rank", testBoard([]placed{{5, 2, first, shogi.FU}}), first, move(5, 2, 5, 1, shogi.FU), false},
+		{"pawn promoted on the last rank", testBoard([]placed{{5, 2, first, shogi.FU}}), first, move(5, 2, 5, 1, shogi.TO), true},
+		{"knight to the second rank", testBoard([]placed{{4, 4, first, shogi.KE}}), first, move(4, 4, 5, 2, shogi.KE), false},
+		{"knight promoted on the second rank", testBoard([]placed{{4, 4, first, shogi.KE}}), first, move(4, 4, 5, 2, shogi.NK), true},
+		{"knight to the third rank unpromoted", testBoard([]placed{{4, 5, first, shogi.KE}}), first, move(4, 5, 5, 3, shogi.KE), true},
+		{"lance drop on the last rank", testBoard(nil, shogi.KY), first, drop(5, 1, shogi.KY), false},
+		{"knight drop on the second rank", testBoard(nil, shogi.KE), first, drop(5, 2, shogi.KE), false},
+		{"pawn of the second player to its last rank", testBoard([]placed{{5, 8, second, shogi.FU}}), second, move(5, 8, 5, 9, shogi.FU), false},
+		{"silver promoted out of the zone", testBoard([]placed{{5, 3, first, shogi.GI}}), first, move(5, 3, 4, 4, shogi.NG), true},
+		{"silver promoted outside of the zone", testBoard([]placed{{5, 5, first, shogi.GI}}), first, move(5, 5, 5, 4, shogi.NG), false},
+		// self check
+		{"pinned silver", testBoard([]placed{{5, 9, first, shogi.OU}, {5, 8, first, shogi.GI}, {5, 1, second, shogi.HI}}), first, move(5, 8, 4, 7, shogi.GI), false},
+		{"pinned silver along the pin", testBoard([]placed{{5, 9, first, shogi.OU}, {5, 8, first, shogi.GI}, {5, 1, second, shogi.HI}}), first, move(5, 8, 5, 7, shogi.GI), true},
+		{"king into check", testBoard([]placed{{5, 9, first, shogi.OU}, {4, 1, second, shogi.HI}}), first, move(5, 9, 4, 9, shogi.OU), false},
+		// pieces and blocks
+		{"bishop blocked", testBoard([]placed{{9, 9, first, shogi.KA}, {8, 8, first, shogi.FU}}), first, move(9, 9, 7, 7, shogi.KA), false},
+		{"capture own piece", testBoard([]placed{{5, 5, first, shogi.KI}, {5, 4, first, shogi.FU}}), first, move(5, 5, 5, 4, shogi.KI), false},
+		{"drop on an occupied square", testBoard([]placed{{5, 5, second, shogi.FU}}, shogi.KI), first, drop(5, 5, shogi.KI), false},
+		{"drop without the piece in hand", testBoard(nil, shogi.KI), first, drop(5, 5, shogi.GI), false},
+	} {
+		if got := c.board.IsLegal(c.turn, c.move); got != c.expect {
+			t.Errorf("%s: IsLegal = %v, expected %v", c.name, got, c.expect)
+		}
+	}
+}
+
+func TestInCheck(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		pieces []placed
+		expect bool
+	}{
+		{"gold in front", []placed{{5, 1, second, shogi.OU}, {5, 2, first, shogi.KI}}, true},
+		{"gold behind", []placed{{5, 1, second, shogi.OU}, {4, 1, first, shogi.KI}}, true},
+		{"silver beside", []placed{{5, 1, second, shogi.OU}, {4, 1, first, shogi.GI}}, false},
+		{"knight", []placed{{5, 1, second, shogi.OU}, {4, 3, first, shogi.KE}}, true},
+		{"knight in front", []placed{{5, 1, second, shogi.OU}, {5, 3, first, shogi.KE}}, false},
+		{"rook from afar", []placed{{5, 1, second, shogi.OU}, {5, 9, first, shogi.HI}}, true},
+		{"rook blocked", []placed{{5, 1, second, shogi.OU}, {5, 5, second, shogi.FU}, {5, 9, first, shogi.HI}}, false},
+		{"horse steps aside", []placed{{5, 1, second, shogi.OU}, {5, 2, first, shogi.UM}}, true},
+		{"lance backwards", []placed{{5, 9, second, shogi.OU}, {5, 1, first, shogi.KY}}, false},
+		{"no king", []placed{{5, 2, first, shogi.KI}}, false},
+	} {
+		if got := testBoard(c.pieces).InCheck(second); got != c.expect {
+			t.Errorf("%s: InCheck = %v, expected %v", c.name, got, c.expect)
+		}
+	}
+}
+
+func TestIsMate(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		pieces []placed
+		expect bool
+	}{
+		{"head gold", []placed{{5, 1, second, shogi.OU}, {5, 2, first, shogi.KI}, {5, 3, first, shogi.FU}}, true},
+		{"head gold captured", []placed{{5, 1, second, shogi.OU}, {5, 2, first, shogi.KI}}, false},
+		{"head gold defended by the gold of the defender", []placed{{5, 1, second, shogi.OU}, {4, 1, second, shogi.KI}, {5, 2, first, shogi.KI}, {5, 3, first, shogi.FU}}, false},
+		{"not checked", []placed{{5, 1, second, shogi.OU}, {5, 3, first, shogi.KI}}, false},
+		{"pawn push into the corner", append([]placed{{1, 2, first, shogi.FU}, {1, 4, first, shogi.KY}}, cornerPieces[:3]...), true},
+	} {
+		if got := testBoard(c.pieces).IsMate(second); got != c.expect {
+			t.Errorf("%s: IsMate = %v, expected %v", c.name, got, c.expect)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	// mate in 1 by dropping the gold on the head of the king
+	b := testBoard([]placed{{5, 1, second, shogi.OU}, {5, 3, first, shogi.FU}}, shogi.KI)
+	for _, c := range []struct {
+		n      int
+		expect bool
+	}{
+		{0, false},
+		{1, true},
+		{3, true},
+	} {
+		ok, err := (&Search{}).CanMate(b, c.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.expect {
+			t.Errorf("CanMate(%d) = %v, expected %v", c.n, ok, c.expect)
+		}
+	}
+
+	// no mate without pieces in hand, whatever the depth
+	ok, err := (&Search{}).CanMate(testBoard([]placed{{5, 1, second, shogi.OU}, {5, 3, first, shogi.FU}}), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("CanMate without pieces in hand")
+	}
+
+	// mated after the drop
+	mated := b.Clone()
+	mated.Apply(first, drop(5, 2, shogi.KI))
+	if ok, err := (&Search{}).MateForced(mated, 0); err != nil || !ok {
+		t.Errorf("MateForced(0) = %v, %v after the mate", ok, err)
+	}
+
+	// the work is bounded
+	if _, err := (&Search{Limit: 1}).CanMate(b, 3); err != ErrLimit {
+		t.Errorf("expected ErrLimit, got %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	b := testBoard([]placed{{5, 5, first, shogi.HI}, {5, 2, second, shogi.KI}, {5, 1, second, shogi.OU}})
+	c := b.Clone()
+	c.Apply(first, move(5, 5, 5, 2, shogi.RY))
+	if c.hands[0][handSlot(shogi.KI)] != 1 {
+		t.Error("captured gold is not in hand")
+	}
+	if b.squares[5][5] != (square{occupied: true, turn: first, piece: shogi.HI}) || b.hands[0][handSlot(shogi.KI)] != 0 {
+		t.Error("the original board is modified")
+	}
+	c.Apply(first, drop(5, 5, shogi.KI))
+	if c.hands[0][handSlot(shogi.KI)] != 0 {
+		t.Error("dropped gold is still in hand")
+	}
+	// promoted pieces are captured as unpromoted
+	c.Apply(second, &Move{Src: shogi.Position{File: 5, Rank: 1}, Dst: shogi.Position{File: 5, Rank: 2}, Piece: shogi.OU})
+	if c.hands[1][handSlot(shogi.HI)] != 1 {
+		t.Error("captured dragon is not a rook in hand")
+	}
+}
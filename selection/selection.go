@@ -0,0 +1,277 @@
+package selection
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine/datastore"
+)
+
+// selection strategies
+const (
+	// StrategyWeighted samples from the whole stock with probabilities proportional to the scores
+	StrategyWeighted = "weighted"
+	// StrategyTop selects randomly from the highest scored problems
+	StrategyTop = "top"
+	// StrategyOldest selects the oldest problems first
+	StrategyOldest = "oldest"
+	// StrategyLeastRecentlyServed selects the problems served least recently on any channel first
+	StrategyLeastRecentlyServed = "least_recently_served"
+)
+
+// CandidatesCount is the maximum number of the candidates
+const CandidatesCount = 10
+
+// Candidate type is a problem to be tried to reserve
+type Candidate struct {
+	Key *datastore.Key
+	// Unused is true if the problem is not served on the channel at the time of the query
+	Unused bool
+}
+
+// strategy returns the candidates in the order to be tried
+type strategy func(ctx context.Context, sel *Selector, problemType generator.Problem, channel string) ([]*Candidate, error)
+
+var strategies = map[string]strategy{
+	StrategyWeighted: func(ctx context.Context, sel *Selector, problemType generator.Problem, channel string) ([]*Candidate, error) {
+		return sel.weightedCandidates(ctx, problemType, channel)
+	},
+	StrategyTop: func(ctx context.Context, sel *Selector, problemType generator.Problem, channel string) ([]*Candidate, error) {
+		candidates, err := sel.orderedCandidates(ctx, problemType, channel, "-score")
+		if err != nil {
+			return nil, err
+		}
+		// shuffle the unused ones and the others separately to keep preferring the unused ones
+		unused := 0
+		for unused < len(candidates) && candidates[unused].Unused {
+			unused++
+		}
+		shuffle(candidates[:unused])
+		shuffle(candidates[unused:])
+		return candidates, nil
+	},
+	StrategyOldest: func(ctx context.Context, sel *Selector, problemType generator.Problem, channel string) ([]*Candidate, error) {
+		return sel.orderedCandidates(ctx, problemType, channel, "created_at")
+	},
+	StrategyLeastRecentlyServed: func(ctx context.Context, sel *Selector, problemType generator.Problem, channel string) ([]*Candidate, error) {
+		return sel.orderedCandidates(ctx, problemType, channel, "served_at")
+	},
+}
+
+// Selector type selects the candidates of the problem to be served on each channel
+type Selector struct {
+	// Default is the strategy of the channels not in Channels, StrategyWeighted if empty
+	Default string
+	// Channels maps the channels to their strategies
+	Channels map[string]string
+	// States are the review states of the problems to be served
+	States []string
+}
+
+// Validate method returns an error if unknown channels or strategies are configured
+func (sel *Selector) Validate() error {
+	names := []string{sel.Default}
+	for channel, name := range sel.Channels {
+		if !entity.IsChannel(channel) {
+			return fmt.Errorf("unknown channel: '%s'", channel)
+		}
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if _, ok := strategies[name]; name != "" && !ok {
+			return fmt.Errorf("unknown selection strategy: '%s'", name)
+		}
+	}
+	return nil
+}
+
+// Candidates method returns the candidates selected by the strategy configured for the channel.
+// The problems not served on the channel are preferred, so that each channel rotates through the whole stock independently.
+func (sel *Selector) Candidates(ctx context.Context, problemType generator.Problem, channel string) ([]*Candidate, error) {
+	name := sel.Channels[channel]
+	if name == "" {
+		name = sel.Default
+	}
+	strategy, ok := strategies[name]
+	if !ok {
+		strategy = strategies[StrategyWeighted]
+	}
+	candidates, err := strategy(ctx, sel, problemType, channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) > 0 && candidates[0].Unused {
+		return candidates, nil
+	}
+	legacy, err := legacyCandidates(ctx, problemType)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 || (len(legacy) > 0 && legacy[0].Unused) {
+		return legacy, nil
+	}
+	return candidates, nil
+}
+
+// legacyCandidates returns the high scored problems saved with the "used" flag shared by all channels,
+// which are not found by the other queries until the "usage" migration. They are migrated when reserved.
+func legacyCandidates(ctx context.Context, problemType generator.Problem) ([]*Candidate, error) {
+	candidates := make([]*Candidate, 0, CandidatesCount)
+	for _, used := range []bool{false, true} {
+		keys, err := datastore.NewQuery(entity.KindNameProblem).
+			Filter("type = ", problemType.Steps()).
+			Filter("used = ", used).
+			Order("-score").
+			Limit(CandidatesCount-len(candidates)).
+			KeysOnly().
+			GetAll(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			candidates = append(candidates, &Candidate{Key: key, Unused: !used})
+		}
+		if len(candidates) >= CandidatesCount {
+			break
+		}
+	}
+	return candidates, nil
+}
+
+// candidateQueries returns the queries for the problems not served on the channel, and then for all problems
+func (sel *Selector) candidateQueries(problemType generator.Problem, channel string, order string) map[bool][]*datastore.Query {
+	queries := map[bool][]*datastore.Query{}
+	for _, unused := range []bool{true, false} {
+		for _, state := range sel.States {
+			query := datastore.NewQuery(entity.KindNameProblem).
+				Filter("type = ", problemType.Steps()).
+				Filter("state = ", state).
+				Order(order)
+			if unused {
+				query = query.Filter("unused = ", channel)
+			}
+			queries[unused] = append(queries[unused], query)
+		}
+	}
+	return queries
+}
+
+// orders maps the orders of the queries to the comparisons of the problems loaded by the projection
+var orders = map[string]func(a, b *entity.Problem) bool{
+	"-score":     func(a, b *entity.Problem) bool { return a.Score > b.Score },
+	"created_at": func(a, b *entity.Problem) bool { return a.CreatedAt.Before(b.CreatedAt) },
+	"served_at":  func(a, b *entity.Problem) bool { return a.ServedAt.Before(b.ServedAt) },
+}
+
+// orderedCandidates returns the first problems in the order.
+// The first problems of each state are merged in the order, since the datastore cannot sort across the queries.
+func (sel *Selector) orderedCandidates(ctx context.Context, problemType generator.Problem, channel string, order string) ([]*Candidate, error) {
+	less := orders[order]
+	queries := sel.candidateQueries(problemType, channel, order)
+	candidates := make([]*Candidate, 0, CandidatesCount)
+	selected := map[string]bool{}
+	for _, unused := range []bool{true, false} {
+		keys := []*datastore.Key{}
+		problems := []*entity.Problem{}
+		for _, query := range queries[unused] {
+			var ps []*entity.Problem
+			ks, err := query.Project(strings.TrimPrefix(order, "-")).Limit(CandidatesCount).GetAll(ctx, &ps)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, ks...)
+			problems = append(problems, ps...)
+		}
+		indexes := make([]int, len(keys))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return less(problems[indexes[i]], problems[indexes[j]])
+		})
+		for _, i := range indexes {
+			if selected[keys[i].Encode()] {
+				continue
+			}
+			selected[keys[i].Encode()] = true
+			candidates = append(candidates, &Candidate{Key: keys[i], Unused: unused})
+			if len(candidates) >= CandidatesCount {
+				return candidates, nil
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// weightedCandidates samples the problems not served on the channel with probabilities proportional to the scores,
+// or the high scored problems if every problem is served on the channel
+func (sel *Selector) weightedCandidates(ctx context.Context, problemType generator.Problem, channel string) ([]*Candidate, error) {
+	queries := sel.candidateQueries(problemType, channel, "-score")
+	for _, unused := range []bool{true, false} {
+		keys := []*datastore.Key{}
+		weights := []float64{}
+		for _, query := range queries[unused] {
+			// served problems are kept for the archive, so they are limited
+			if !unused {
+				query = query.Limit(entity.ProblemStockCount)
+			}
+			var problems []*entity.Problem
+			ks, err := query.Project("score").GetAll(ctx, &problems)
+			if err != nil {
+				return nil, err
+			}
+			for i, p := range problems {
+				keys = append(keys, ks[i])
+				weights = append(weights, scoreWeight(p.Score))
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		candidates := make([]*Candidate, 0, CandidatesCount)
+		for _, i := range weightedSample(weights, CandidatesCount) {
+			candidates = append(candidates, &Candidate{Key: keys[i], Unused: unused})
+		}
+		return candidates, nil
+	}
+	return []*Candidate{}, nil
+}
+
+func shuffle(candidates []*Candidate) {
+	for i := len(candidates) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+}
+
+// scoreWeight returns the weight of the score, which is positive even for the lowest score
+func scoreWeight(score int) float64 {
+	if score < 0 {
+		score = 0
+	}
+	return float64(score + 1)
+}
+
+// weightedSample returns at most n indexes sampled without replacement with probabilities proportional to the weights
+func weightedSample(weights []float64, n int) []int {
+	// Efraimidis-Spirakis: take the n largest of u^(1/w)
+	keys := make([]float64, len(weights))
+	indexes := make([]int, len(weights))
+	for i, w := range weights {
+		keys[i] = math.Pow(rand.Float64(), 1/w)
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return keys[indexes[i]] > keys[indexes[j]]
+	})
+	if len(indexes) > n {
+		indexes = indexes[:n]
+	}
+	return indexes
+}
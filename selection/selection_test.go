@@ -0,0 +1,226 @@
+package selection
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/aetest"
+	"google.golang.org/appengine/datastore"
+)
+
+// chi-square values at the significance level of 0.001 for the degrees of freedom
+var chiSquareCritical = map[int]float64{
+	1: 10.828,
+	2: 13.816,
+	3: 16.266,
+	4: 18.467,
+	5: 20.515,
+}
+
+func TestWeightedSampleDistribution(t *testing.T) {
+	rand.Seed(1)
+	scores := []int{-5, 0, 1, 3, 8, 15}
+	weights := make([]float64, len(scores))
+	total := 0.0
+	for i, score := range scores {
+		weights[i] = scoreWeight(score)
+		total += weights[i]
+	}
+
+	const trials = 100000
+	counts := make([]int, len(weights))
+	for i := 0; i < trials; i++ {
+		sampled := weightedSample(weights, 1)
+		if len(sampled) != 1 {
+			t.Fatalf("sampled %d indexes, expected 1", len(sampled))
+		}
+		counts[sampled[0]]++
+	}
+	chiSquare := 0.0
+	for i, count := range counts {
+		expected := trials * weights[i] / total
+		d := float64(count) - expected
+		chiSquare += d * d / expected
+	}
+	if critical := chiSquareCritical[len(weights)-1]; chiSquare > critical {
+		t.Errorf("chi-square %f exceeds %f: counts %v for weights %v", chiSquare, critical, counts, weights)
+	}
+}
+
+func TestWeightedSampleWithoutReplacement(t *testing.T) {
+	weights := []float64{1, 1, 2, 3, 5, 8, 13}
+	for _, n := range []int{0, 3, len(weights), len(weights) + 3} {
+		sampled := weightedSample(weights, n)
+		expected := n
+		if expected > len(weights) {
+			expected = len(weights)
+		}
+		if len(sampled) != expected {
+			t.Errorf("sampled %d indexes for n = %d, expected %d", len(sampled), n, expected)
+		}
+		seen := map[int]bool{}
+		for _, i := range sampled {
+			if i < 0 || i >= len(weights) || seen[i] {
+				t.Errorf("invalid or duplicated index %d in %v", i, sampled)
+			}
+			seen[i] = true
+		}
+	}
+}
+
+type testProblem struct {
+	score int
+	used  bool
+	// state is approved if empty
+	state     string
+	createdAt time.Time
+	servedAt  time.Time
+	key       *datastore.Key
+}
+
+// putTestProblems puts the problems of type 3 with the scores, which are used on the Twitter channel if used is true
+func putTestProblems(t *testing.T, ctx context.Context, problems []*testProblem) {
+	for _, p := range problems {
+		state := p.state
+		if state == "" {
+			state = entity.ProblemStateApproved
+		}
+		problem := &entity.Problem{
+			Type:      3,
+			Unused:    entity.NewUnused(),
+			State:     state,
+			Score:     p.score,
+			CreatedAt: p.createdAt,
+			ServedAt:  p.servedAt,
+		}
+		if p.used {
+			problem.MarkUsed(entity.ChannelTwitter)
+		}
+		key, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, entity.KindNameProblem, nil), problem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.key = key
+	}
+}
+
+func newTestContext(t *testing.T) (context.Context, func()) {
+	inst, err := aetest.NewInstance(&aetest.Options{StronglyConsistentDatastore: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := inst.NewRequest("GET", "/", nil)
+	if err != nil {
+		inst.Close()
+		t.Fatal(err)
+	}
+	return appengine.NewContext(req), func() { inst.Close() }
+}
+
+func TestStrategies(t *testing.T) {
+	ctx, done := newTestContext(t)
+	defer done()
+
+	base := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	// approved, pending and rejected in turn, and the rejected ones are not served
+	states := []string{entity.ProblemStateApproved, entity.ProblemStatePending, entity.ProblemStateRejected}
+	problems := []*testProblem{}
+	for i := 0; i < 2*CandidatesCount+5; i++ {
+		problems = append(problems, &testProblem{
+			score:     (i * 7) % 20,
+			used:      i%4 == 0,
+			state:     states[i%len(states)],
+			createdAt: base.Add(time.Duration(i) * time.Hour),
+			// served in the reverse order of creation
+			servedAt: base.Add(time.Duration(100-i) * time.Hour),
+		})
+	}
+	putTestProblems(t, ctx, problems)
+
+	unused := []*testProblem{}
+	for _, p := range problems {
+		if !p.used && p.state != entity.ProblemStateRejected {
+			unused = append(unused, p)
+		}
+	}
+	for _, c := range []struct {
+		strategy string
+		less     func(a, b *testProblem) bool
+		ordered  bool
+	}{
+		{StrategyOldest, func(a, b *testProblem) bool { return a.createdAt.Before(b.createdAt) }, true},
+		{StrategyLeastRecentlyServed, func(a, b *testProblem) bool { return a.servedAt.Before(b.servedAt) }, true},
+		{StrategyTop, func(a, b *testProblem) bool { return a.score > b.score }, false},
+	} {
+		sorted := append([]*testProblem{}, unused...)
+		sort.SliceStable(sorted, func(i, j int) bool { return c.less(sorted[i], sorted[j]) })
+		if len(sorted) > CandidatesCount {
+			sorted = sorted[:CandidatesCount]
+		}
+		expected := map[int64]int{}
+		for i, p := range sorted {
+			expected[p.key.IntID()] = i
+		}
+
+		sel := &Selector{Default: c.strategy, States: []string{entity.ProblemStateApproved, entity.ProblemStatePending}}
+		candidates, err := sel.Candidates(ctx, generator.Type3, entity.ChannelTwitter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != len(sorted) {
+			t.Fatalf("%s: %d candidates, expected %d", c.strategy, len(candidates), len(sorted))
+		}
+		for i, candidate := range candidates {
+			if !candidate.Unused {
+				t.Errorf("%s: candidate %d is not unused", c.strategy, i)
+			}
+			j, ok := expected[candidate.Key.IntID()]
+			if !ok {
+				t.Errorf("%s: unexpected candidate %v", c.strategy, candidate.Key.IntID())
+				continue
+			}
+			if c.ordered && i != j {
+				t.Errorf("%s: candidate %v at %d, expected at %d", c.strategy, candidate.Key.IntID(), i, j)
+			}
+		}
+	}
+}
+
+func TestStrategiesPreferUnused(t *testing.T) {
+	ctx, done := newTestContext(t)
+	defer done()
+
+	base := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	problems := []*testProblem{
+		{score: 19, used: true, createdAt: base, servedAt: base},
+		{score: 0, used: false, createdAt: base.Add(time.Hour), servedAt: base.Add(time.Hour)},
+		{score: 18, used: true, createdAt: base.Add(2 * time.Hour), servedAt: base.Add(2 * time.Hour)},
+	}
+	putTestProblems(t, ctx, problems)
+
+	for _, strategy := range []string{StrategyWeighted, StrategyTop, StrategyOldest, StrategyLeastRecentlyServed} {
+		sel := &Selector{Default: strategy, States: []string{entity.ProblemStateApproved}}
+		// the unused problem comes first on the channel, and the used ones follow
+		candidates, err := sel.Candidates(ctx, generator.Type3, entity.ChannelTwitter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) == 0 || !candidates[0].Unused || candidates[0].Key.IntID() != problems[1].key.IntID() {
+			t.Errorf("%s: the unused problem is not selected first", strategy)
+		}
+		// every problem is unused on the other channel
+		candidates, err = sel.Candidates(ctx, generator.Type3, entity.ChannelLineBot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != len(problems) {
+			t.Errorf("%s: %d candidates on the other channel, expected %d", strategy, len(candidates), len(problems))
+		}
+	}
+}
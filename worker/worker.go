@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sugyan/shogi/logic/problem/generator"
+	"github.com/sugyan/tsumeshogi-bot/entity"
+	"github.com/sugyan/tsumeshogi-bot/generate"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+// Worker type keeps the stock of each type at entity.ProblemStockCount by generating problems in background
+type Worker struct {
+	Generator *generate.Generator
+	// Workers is the number of problems generated concurrently
+	Workers int
+	// Nice is the ratio of the pause after each generation to its duration, to leave CPU for serving requests
+	Nice float64
+	// Interval is the interval of checking the stock
+	Interval time.Duration
+	// Timeout limits generating and saving each problem if positive, so that a hung generation never blocks the others
+	Timeout time.Duration
+}
+
+// Run method fills the stock at every interval until the context is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		for _, problemType := range []generator.Problem{
+			generator.Type1,
+			generator.Type3,
+			generator.Type5,
+		} {
+			if err := w.fill(ctx, problemType); err != nil {
+				log.Errorf(ctx, "failed to fill stock of type %d: %v", problemType.Steps(), err.Error())
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) fill(ctx context.Context, problemType generator.Problem) error {
+	count, err := generate.CountStock(ctx, problemType)
+	if err != nil {
+		return err
+	}
+	shortage := entity.ProblemStockCount - count
+	if shortage <= 0 {
+		return nil
+	}
+	log.Infof(ctx, "type %d: %d", problemType.Steps(), count)
+
+	workers := w.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	// stop generating after the first error
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, workers)
+loop:
+	for i := 0; i < shortage; i++ {
+		select {
+		case <-ctx.Done():
+			break loop
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			key, _, err := w.generate(ctx, problemType)
+			if err == generate.ErrTimeout && ctx.Err() == nil {
+				// the other positions may be generated in time
+				log.Warningf(ctx, "failed to generate problem of type %d: %v", problemType.Steps(), err.Error())
+				return
+			}
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			log.Infof(ctx, "problem %v saved", key.IntID())
+			w.pause(ctx, time.Since(start))
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// generate generates a problem, and returns generate.ErrTimeout if it exceeds the timeout
+func (w *Worker) generate(ctx context.Context, problemType generator.Problem) (*datastore.Key, *entity.Problem, error) {
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+	key, problem, err := w.Generator.Generate(ctx, problemType)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, nil, generate.ErrTimeout
+	}
+	return key, problem, err
+}
+
+// pause sleeps in proportion to the duration of the generation
+func (w *Worker) pause(ctx context.Context, d time.Duration) {
+	if w.Nice <= 0 {
+		return
+	}
+	timer := time.NewTimer(time.Duration(float64(d) * w.Nice))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}